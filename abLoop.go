@@ -0,0 +1,264 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"log"
+	"math"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/speaker"
+)
+
+const loopCrossfadeDuration = 15 * time.Millisecond // short enough to keep the loop tight, long enough to avoid clicks
+
+// Loop marker being dragged on the seek bar and where to, see loopMarkerAt
+var draggingLoopMarker loopMarker
+var loopDragPos float32
+
+type loopMarker int
+
+const (
+	noMarker loopMarker = iota
+	markerA
+	markerB
+)
+
+// abLoop repeats the region [start, end) of s once playback reaches end, -1 marks an unset point
+// When fadeLen is set the fadeLen samples after start are blended into the samples before end
+type abLoop struct {
+	s          beep.StreamSeeker
+	start, end int
+	fadeLen    int
+	head       [][2]float64 // samples [start, start+fadeLen) read ahead for the crossfade
+}
+
+func newABLoop(s beep.StreamSeeker) *abLoop {
+	return &abLoop{s: s, start: -1, end: -1}
+}
+
+func (l *abLoop) active() bool {
+	return l.start >= 0 && l.end > l.start
+}
+
+// Set the loop points, either may be -1 to unset it. Reads ahead the crossfade from start
+// which moves s, the caller must hold the speaker lock
+func (l *abLoop) set(start, end int, fadeLen int) {
+	if start >= 0 && end >= 0 && end < start {
+		start, end = end, start
+	}
+	l.start, l.end = min(start, l.s.Len()), min(end, l.s.Len())
+	l.fadeLen, l.head = 0, l.head[:0]
+	if !l.active() || fadeLen <= 0 {
+		return
+	}
+
+	pos := l.s.Position()
+	defer func() {
+		if err := l.s.Seek(pos); err != nil {
+			log.Println("abLoop: couldn't restore position:", err)
+		}
+	}()
+	if err := l.s.Seek(l.start); err != nil {
+		log.Println("abLoop: couldn't read loop start, looping without crossfade:", err)
+		return
+	}
+	fadeLen = min(fadeLen, (l.end-l.start)/2)
+	if cap(l.head) < fadeLen {
+		l.head = make([][2]float64, 0, fadeLen)
+	}
+	for len(l.head) < fadeLen {
+		n, ok := l.s.Stream(l.head[len(l.head):fadeLen])
+		l.head = l.head[:len(l.head)+n]
+		if !ok {
+			break
+		}
+	}
+	l.fadeLen = len(l.head)
+}
+
+func (l *abLoop) Stream(samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) {
+		pos := l.s.Position()
+		looping := l.active() && pos < l.end
+		toStream := samples[n:]
+		if looping {
+			toStream = toStream[:min(len(toStream), l.end-pos)]
+		}
+
+		sn, sok := l.s.Stream(toStream)
+		if looping && l.fadeLen > 0 {
+			l.crossfade(toStream[:sn], pos)
+		}
+		n += sn
+		if looping && (pos+sn >= l.end || !sok) {
+			// Continue after the part of the loop start that was already blended in
+			if err := l.s.Seek(l.start + l.fadeLen); err != nil {
+				log.Println("abLoop: seek to loop start failed:", err)
+				return n, n > 0
+			}
+			continue
+		}
+		if !sok {
+			return n, n > 0
+		}
+	}
+	return n, true
+}
+
+// Blend the loop start into samples at position pos if they're within fadeLen of the end
+func (l *abLoop) crossfade(samples [][2]float64, pos int) {
+	fadeStart := l.end - l.fadeLen
+	for i := max(fadeStart-pos, 0); i < len(samples); i++ {
+		j := pos + i - fadeStart
+		t := (float64(j) + 0.5) / float64(l.fadeLen) * math.Pi / 2
+		fadeOut, fadeIn := math.Cos(t), math.Sin(t) // equal power
+		samples[i][0] = samples[i][0]*fadeOut + l.head[j][0]*fadeIn
+		samples[i][1] = samples[i][1]*fadeOut + l.head[j][1]*fadeIn
+	}
+}
+
+func (l *abLoop) Err() error {
+	return l.s.Err()
+}
+
+// Set loop marker A or B to pos (in samples), -1 unsets it
+func (p *playbackUnit) setLoopMarker(marker loopMarker, pos int) {
+	if p == nil {
+		return
+	}
+	speaker.Lock()
+	defer speaker.Unlock()
+	start, end := p.loop.start, p.loop.end
+	if marker == markerA {
+		start = pos
+	} else {
+		end = pos
+	}
+	p.loop.set(start, end, p.loopFadeLen())
+}
+
+// Set loop marker A or B to the current playback position
+func (p *playbackUnit) setLoopMarkerHere(marker loopMarker) {
+	if p == nil {
+		return
+	}
+	speaker.Lock()
+	pos := p.streamer.Position()
+	speaker.Unlock()
+	p.setLoopMarker(marker, pos)
+}
+
+func (p *playbackUnit) clearLoop() {
+	if p == nil {
+		return
+	}
+	speaker.Lock()
+	p.loop.set(-1, -1, 0)
+	speaker.Unlock()
+}
+
+// Turn the crossfade at the loop point on or off
+func (p *playbackUnit) setLoopCrossfade(enabled bool) {
+	if p == nil {
+		return
+	}
+	speaker.Lock()
+	p.loopCrossfade = enabled
+	p.loop.set(p.loop.start, p.loop.end, p.loopFadeLen())
+	speaker.Unlock()
+}
+
+// Return the length of the crossfade at the loop point, caller must hold the speaker lock
+func (p *playbackUnit) loopFadeLen() int {
+	if !p.loopCrossfade {
+		return 0
+	}
+	return p.format.SampleRate.N(loopCrossfadeDuration)
+}
+
+// Return the loop markers as ratios of the track (0.0 to 1.0), -1 for unset markers
+func (p *playbackUnit) loopRatios() (a, b float32) {
+	if p == nil {
+		return -1, -1
+	}
+	speaker.Lock()
+	start, end, total := p.loop.start, p.loop.end, p.streamer.Len()
+	speaker.Unlock()
+	toRatio := func(pos int) float32 {
+		if pos < 0 || total <= 0 {
+			return -1
+		}
+		return float32(pos) / float32(total)
+	}
+	return toRatio(start), toRatio(end)
+}
+
+func (p *playbackUnit) hasLoopMarkers() bool {
+	a, b := p.loopRatios()
+	return a >= 0 || b >= 0
+}
+
+// Return the loop marker within grab pixels of x on a seek bar of width, if any
+func loopMarkerAt(x float32, width, grab int) loopMarker {
+	a, b := currentUnit().loopRatios()
+	if b >= 0 && math.Abs(float64(x-b*float32(width))) <= float64(grab) {
+		return markerB
+	}
+	if a >= 0 && math.Abs(float64(x-a*float32(width))) <= float64(grab) {
+		return markerA
+	}
+	return noMarker
+}
+
+// Move the dragged loop marker to ratio of the track
+func finishLoopMarkerDrag(ratio float32) {
+	marker := draggingLoopMarker
+	draggingLoopMarker = noMarker
+	unit := currentUnit()
+	if unit == nil {
+		return
+	}
+	ratio = min(max(ratio, 0), 1)
+	unit.setLoopMarker(marker, int(ratio*float32(unit.streamer.Len())))
+}
+
+// Draw the A-B loop region and its markers on top of the progress bar
+func renderLoopMarkers(gtx C) D {
+	unit := currentUnit()
+	if unit == nil {
+		return layout.Dimensions{}
+	}
+	a, b := unit.loopRatios()
+	switch draggingLoopMarker {
+	case markerA:
+		a = loopDragPos
+	case markerB:
+		b = loopDragPos
+	}
+	if a < 0 && b < 0 {
+		return layout.Dimensions{}
+	}
+
+	width, height := float32(gtx.Constraints.Max.X), gtx.Constraints.Max.Y
+	markerColor := color.NRGBA{R: 80, G: 220, B: 120, A: 255}
+	if a >= 0 && b >= 0 {
+		left, right := int(min(a, b)*width), int(max(a, b)*width)
+		paint.FillShape(gtx.Ops, color.NRGBA{R: 80, G: 220, B: 120, A: 60},
+			clip.Rect{Min: image.Pt(left, 0), Max: image.Pt(right, height)}.Op())
+	}
+	handle := gtx.Dp(6)
+	for _, ratio := range []float32{a, b} {
+		if ratio < 0 {
+			continue
+		}
+		x := int(ratio * width)
+		paint.FillShape(gtx.Ops, markerColor, clip.Rect{Min: image.Pt(x-1, 0), Max: image.Pt(x+1, height)}.Op())
+		paint.FillShape(gtx.Ops, markerColor, clip.Rect{Min: image.Pt(x-handle/2, 0), Max: image.Pt(x+handle/2, handle)}.Op())
+	}
+	return layout.Dimensions{Size: gtx.Constraints.Max}
+}
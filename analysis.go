@@ -0,0 +1,62 @@
+package main
+
+import (
+	"log"
+	"runtime"
+
+	"quickClip/player"
+)
+
+// trackAnalyzer consumes every sample of a track while it's decoded in the background
+type trackAnalyzer interface {
+	process(samples [][2]float64)
+	finish() // called once the whole track was processed
+}
+
+// Decode the unit's source once in the background and feed it to the track analyzers (overview etc.)
+// NOTE: stops early when the unit is closed
+func (p *playbackUnit) startAnalysis() {
+	decoder, format, err := p.openDecoder()
+	if err != nil {
+		log.Println("Couldn't start track analysis:", err)
+		return
+	}
+	p.overview = player.NewOverview(decoder.Len())
+	p.spectrogram = newTrackSpectrogram(decoder.Len(), format.SampleRate)
+	p.loudness = newLoudnessAnalyzer(format.SampleRate, func(loudnessResult) {
+		p.applyNormalization(currentSettings().normalize) // called from the analysis goroutine
+	})
+	analyzers := []trackAnalyzer{overviewAnalyzer{p.overview}, p.spectrogram, p.loudness}
+
+	go func() {
+		defer decoder.Close()
+		if key, err := sourceCacheKey(p.ctx, p.source); err == nil {
+			p.loudness.useCache(key) // before the analysis so a new measurement is stored under the key
+		} else if p.ctx.Err() == nil {
+			log.Println("Couldn't look up the loudness cache:", err)
+		}
+		samples := make([][2]float64, 4096)
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			default:
+			}
+
+			n, ok := decoder.Stream(samples)
+			for _, a := range analyzers {
+				a.process(samples[:n])
+			}
+			if !ok {
+				break
+			}
+			runtime.Gosched() // keep the UI responsive on single threaded (wasm) targets
+		}
+		if err := decoder.Err(); err != nil {
+			log.Println("Track analysis decode error:", err)
+		}
+		for _, a := range analyzers {
+			a.finish()
+		}
+	}()
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gopxl/beep/v2"
+	"quickClip/player"
+)
+
+// broadcastMetadata holds the BWF bext and iXML chunks of field and broadcast recordings, which tag.ReadFrom skips
+type broadcastMetadata struct {
+	// bext
+	Description   string
+	Originator    string
+	Reference     string // OriginatorReference
+	Date, Time    string // OriginationDate and OriginationTime, e.g. "2024-05-01" and "14:03:22"
+	TimeReference uint64 // samples since midnight of the first sample
+	CodingHistory string
+
+	// iXML
+	Project, Scene, Take, Tape, Note string
+	Tracks                           []string // track names in channel order
+}
+
+// Layout of the fixed part of a bext chunk (EBU Tech 3285), the coding history follows it
+type bextChunk struct {
+	Description         [256]byte
+	Originator          [32]byte
+	OriginatorReference [32]byte
+	OriginationDate     [10]byte
+	OriginationTime     [8]byte
+	TimeReference       uint64
+	Version             uint16
+	UMID                [64]byte
+	Loudness            [5]int16
+	Reserved            [180]byte
+}
+
+type ixmlDocument struct {
+	Project string `xml:"PROJECT"`
+	Scene   string `xml:"SCENE"`
+	Take    string `xml:"TAKE"`
+	Tape    string `xml:"TAPE"`
+	Note    string `xml:"NOTE"`
+	Tracks  []struct {
+		Index int    `xml:"CHANNEL_INDEX"`
+		Name  string `xml:"NAME"`
+	} `xml:"TRACK_LIST>TRACK"`
+}
+
+// Read the bext and iXML chunks of a WAV file, nil if it has neither
+// NOTE: the fields of the chunks that could be parsed are returned along with the errors of the others
+func readBroadcastMetadata(r io.ReadSeeker) (*broadcastMetadata, error) {
+	form, chunks, err := player.ReadChunks(r)
+	if err != nil || form != "WAVE" {
+		return nil, nil // not a WAV file
+	}
+	var b *broadcastMetadata
+	var errs []error
+	for _, c := range chunks {
+		if c.ID != "bext" && c.ID != "iXML" {
+			continue
+		}
+		data, err := player.ReadChunk(r, c)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s chunk: %w", c.ID, err))
+			continue
+		}
+		parsed := b
+		if parsed == nil {
+			parsed = &broadcastMetadata{}
+		}
+		if c.ID == "bext" {
+			err = parsed.parseBext(data)
+		} else {
+			err = parsed.parseIXML(data)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		b = parsed
+	}
+	return b, errors.Join(errs...)
+}
+
+func (b *broadcastMetadata) parseBext(data []byte) error {
+	var bext bextChunk
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &bext); err != nil {
+		return fmt.Errorf("bext chunk: %w", err)
+	}
+	text := func(field []byte) string {
+		return strings.TrimSpace(string(bytes.TrimRight(field, "\x00")))
+	}
+	b.Description = text(bext.Description[:])
+	b.Originator = text(bext.Originator[:])
+	b.Reference = text(bext.OriginatorReference[:])
+	b.Date = text(bext.OriginationDate[:])
+	b.Time = text(bext.OriginationTime[:])
+	b.TimeReference = bext.TimeReference
+	b.CodingHistory = text(data[binary.Size(bext):])
+	return nil
+}
+
+func (b *broadcastMetadata) parseIXML(data []byte) error {
+	var doc ixmlDocument
+	if err := xml.Unmarshal(bytes.TrimRight(data, "\x00"), &doc); err != nil {
+		return fmt.Errorf("iXML chunk: %w", err)
+	}
+	b.Project, b.Scene, b.Take = strings.TrimSpace(doc.Project), strings.TrimSpace(doc.Scene), strings.TrimSpace(doc.Take)
+	b.Tape, b.Note = strings.TrimSpace(doc.Tape), strings.TrimSpace(doc.Note)
+	for _, track := range doc.Tracks {
+		if track.Index < 1 || track.Index > 64 { // 1-based
+			continue
+		}
+		if len(b.Tracks) < track.Index {
+			b.Tracks = append(b.Tracks, make([]string, track.Index-len(b.Tracks))...)
+		}
+		b.Tracks[track.Index-1] = strings.TrimSpace(track.Name)
+	}
+	return nil
+}
+
+// Format the time reference as the time of day of the first sample, e.g. "14:03:22.500"
+func (b *broadcastMetadata) timecode(rate beep.SampleRate) string {
+	d := rate.D(int(b.TimeReference))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60, d.Milliseconds()%1000)
+}
+
+// Return label: value pairs of the fields that are set, e.g. for the options dialog and the info command
+func (b *broadcastMetadata) fields(rate beep.SampleRate) [][2]string {
+	var fields [][2]string
+	add := func(label, value string) {
+		if value != "" {
+			fields = append(fields, [2]string{label, value})
+		}
+	}
+	add("Description", b.Description)
+	add("Originator", b.Originator)
+	add("Reference", b.Reference)
+	add("Recorded", strings.TrimSpace(b.Date+" "+b.Time))
+	if b.TimeReference > 0 {
+		add("Timecode", b.timecode(rate))
+	}
+	add("Project", b.Project)
+	add("Scene", b.Scene)
+	add("Take", b.Take)
+	add("Tape", b.Tape)
+	add("Note", b.Note)
+	if len(b.Tracks) > 0 {
+		add("Tracks", strings.Join(b.Tracks, ", "))
+	}
+	return fields
+}
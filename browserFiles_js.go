@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"syscall/js"
+
+	"gioui.org/x/explorer"
+)
+
+// Open the browser's file picker for one or more files
+// NOTE: explorer's readers can only read forward, these read the picked files at any position instead
+// so large files don't have to be kept in memory to be seeked
+func chooseBrowserFiles(extensions ...string) ([]io.ReadCloser, error) {
+	picked := make(chan []io.ReadCloser, 1)
+	document := js.Global().Get("document")
+	input := document.Call("createElement", "input")
+	onPicked := js.FuncOf(func(this js.Value, args []js.Value) any {
+		files := input.Get("files")
+		readers := make([]io.ReadCloser, files.Length())
+		for i := range readers {
+			readers[i] = newBlobReader(files.Index(i))
+		}
+		select {
+		case picked <- readers:
+		default: // both change and cancel fired
+		}
+		return nil
+	})
+	defer onPicked.Release()
+
+	input.Call("addEventListener", "change", onPicked)
+	input.Call("addEventListener", "cancel", onPicked)
+	input.Set("type", "file")
+	input.Set("multiple", true)
+	input.Set("style", "display:none;")
+	if len(extensions) > 0 {
+		input.Set("accept", strings.Join(extensions, ","))
+	}
+	document.Get("body").Call("appendChild", input)
+	input.Call("click")
+
+	readers := <-picked
+	input.Call("remove")
+	if len(readers) == 0 {
+		return nil, explorer.ErrUserDecline
+	}
+	return readers, nil
+}
+
+// blobReader reads a browser File (a Blob) by slicing the requested range out of it
+// NOTE: every read waits for a promise, it isn't an io.ReaderAt so MakeSeekable reads it in cached chunks
+type blobReader struct {
+	blob js.Value
+	size int64
+	pos  int64
+}
+
+func newBlobReader(blob js.Value) *blobReader {
+	return &blobReader{blob: blob, size: int64(blob.Get("size").Float())}
+}
+
+func (b *blobReader) readAt(p []byte, off int64) (int, error) {
+	if off >= b.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), b.size)
+
+	result := make(chan js.Value, 1)
+	onRead := js.FuncOf(func(this js.Value, args []js.Value) any {
+		result <- args[0]
+		return nil
+	})
+	defer onRead.Release()
+	onFail := js.FuncOf(func(this js.Value, args []js.Value) any {
+		result <- js.Undefined()
+		return nil
+	})
+	defer onFail.Release()
+	b.blob.Call("slice", off, end).Call("arrayBuffer").Call("then", onRead, onFail)
+
+	buffer := <-result
+	if !buffer.Truthy() {
+		return 0, fmt.Errorf("couldn't read %v bytes at %v of the file", end-off, off)
+	}
+	n := js.CopyBytesToGo(p, js.Global().Get("Uint8Array").New(buffer))
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (b *blobReader) Read(p []byte) (int, error) {
+	n, err := b.readAt(p, b.pos)
+	b.pos += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil // report EOF on the next read like other readers
+	}
+	return n, err
+}
+
+func (b *blobReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += b.pos
+	case io.SeekEnd:
+		offset += b.size
+	default:
+		return 0, fmt.Errorf("blobReader: invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("blobReader: negative position")
+	}
+	b.pos = offset
+	return offset, nil
+}
+
+func (b *blobReader) Close() error {
+	return nil // nothing to release, the browser owns the file
+}
@@ -0,0 +1,14 @@
+//go:build !js
+
+package main
+
+import (
+	"io"
+
+	"gioui.org/x/explorer"
+)
+
+// Only the browser has its own file picker, see browserFiles_js.go
+func chooseBrowserFiles(_ ...string) ([]io.ReadCloser, error) {
+	return nil, explorer.ErrNotAvailable
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"quickClip/player"
+	"quickClip/player/speakerout"
+)
+
+// cliCommand is a headless subcommand, run instead of opening the window when it's the first argument
+type cliCommand struct {
+	usage string
+	run   func(args []string) error
+}
+
+var cliCommands = map[string]cliCommand{
+	"play":     {"play FILE", cliPlay},
+	"info":     {"info FILE", cliInfo},
+	"clip":     {"clip FILE --from 1:23 [--to 1:45] -o out.wav", cliClip},
+	"waveform": {"waveform FILE [--size 1600x400] -o out.png|out.svg", cliWaveform},
+}
+
+var errUsage = errors.New("usage")
+
+// Report whether args (without the program name) are for the CLI instead of files to open in the window
+// Anything else than paths of existing files, e.g. a flag or a mistyped command, is reported by the CLI
+func isCLIArgs(args []string) bool {
+	if len(args) > 0 {
+		if _, ok := cliCommands[args[0]]; ok {
+			return true
+		}
+	}
+	for _, arg := range args {
+		if !isFileArg(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// Report whether arg is a file to open, or the process serial number macOS passes to apps opened from Finder
+func isFileArg(arg string) bool {
+	if strings.HasPrefix(arg, "-psn_") {
+		return true
+	}
+	if strings.HasPrefix(arg, "-") {
+		return false
+	}
+	_, err := os.Stat(arg)
+	return err == nil
+}
+
+// Run the subcommand in args and return the exit code
+func runCLI(args []string) int {
+	log.SetOutput(io.Discard) // the decoders' and player's logs are for the window's console, errors are printed below
+	cmd, ok := cliCommands[args[0]]
+	switch {
+	case ok:
+	case args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help":
+		cliUsage()
+		return 0
+	default:
+		for _, arg := range args {
+			if !isFileArg(arg) {
+				fmt.Fprintf(os.Stderr, "quickclip: unknown command or file %q\n", arg)
+				break
+			}
+		}
+		cliUsage()
+		return 2
+	}
+	err := cmd.run(args[1:])
+	if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+		fmt.Fprintln(os.Stderr, "usage: quickclip", cmd.usage)
+		return 2
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, "quickclip:", err)
+		return 1
+	}
+	return 0
+}
+
+func cliUsage() {
+	fmt.Fprintln(os.Stderr, "usage: quickclip [command | FILE...]")
+	fmt.Fprintln(os.Stderr, "Without a command the player window is opened with the files, commands:")
+	for _, name := range []string{"play", "info", "clip", "waveform"} {
+		fmt.Fprintln(os.Stderr, "  quickclip", cliCommands[name].usage)
+	}
+}
+
+// Parse args with fs and return the positional arguments, flags may come before or after them
+func parseCLIArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+// Open FILE, the only positional argument, as a unit without playback or background analysis
+// NOTE: call the returned function to close the decoder and file
+func openCLIFile(positional []string) (*playbackUnit, func(), error) {
+	if len(positional) != 1 {
+		return nil, nil, errUsage
+	}
+	file, err := os.Open(positional[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	unit, err := openPlaybackUnit(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return unit, func() {
+		if closer, ok := unit.streamer.(io.Closer); ok {
+			closer.Close()
+		}
+		file.Close()
+	}, nil
+}
+
+// Parse a position like "83.5", "1:23", "1:02:03.5" or a Go duration like "1m23s"
+func parseTimestamp(s string) (time.Duration, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		if d < 0 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		return d, nil
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	var seconds float64
+	for _, part := range parts {
+		v, err := strconv.ParseFloat(part, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid time %q", s)
+		}
+		seconds = seconds*60 + v
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// Play FILE on the speaker until it ends or is interrupted, without the window's background analysis
+func cliPlay(args []string) error {
+	fs := flag.NewFlagSet("play", flag.ContinueOnError)
+	volume := fs.Float64("volume", player.DefaultVolume, "volume from 0.0 to 1.0")
+	positional, err := parseCLIArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	unit, closeFile, err := openCLIFile(positional)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+	unit.setupPlayback(currentSettings())
+
+	initSpeaker()
+	p := player.New(speakerout.Speaker)
+	p.SetVolume(*volume)
+	events, _ := p.Subscribe()
+	p.LoadTrack(unit)
+	defer p.Eject()
+	if err := p.Play(); err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		fmt.Fprintf(os.Stderr, "\r%s / %s", formatDuration(p.Position()), formatDuration(p.Duration()))
+		select {
+		case event := <-events:
+			if e, ok := event.(player.StateChanged); ok && e.To == player.Finished {
+				fmt.Fprintln(os.Stderr)
+				return nil
+			}
+		case <-ctx.Done():
+			fmt.Fprintln(os.Stderr)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Print the format and tags of FILE
+func cliInfo(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	positional, err := parseCLIArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	unit, closeFile, err := openCLIFile(positional)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+
+	format := unit.format
+	fmt.Printf("File:        %s\n", positional[0])
+	fmt.Printf("Type:        %s\n", strings.TrimPrefix(unit.AudioType, "."))
+	fmt.Printf("Sample rate: %d Hz\n", format.SampleRate)
+	if d := unit.downmix(); d != nil && len(d.Channels()) > 2 {
+		fmt.Printf("Channels:    %d %v, downmixed to stereo\n", len(d.Channels()), d.Channels())
+	} else {
+		fmt.Printf("Channels:    %d\n", format.NumChannels)
+	}
+	fmt.Printf("Bit depth:   %d\n", format.Precision*8)
+	fmt.Printf("Duration:    %s (%d samples)\n", formatDuration(format.SampleRate.D(unit.streamer.Len())), unit.streamer.Len())
+	if m := unit.Metadata; m != nil {
+		for _, field := range []struct{ name, value string }{
+			{"Title", m.Title()}, {"Artist", m.Artist()}, {"Album", m.Album()}, {"Genre", m.Genre()},
+		} {
+			if field.value != "" {
+				fmt.Printf("%-12s %s\n", field.name+":", field.value)
+			}
+		}
+		if m.Year() != 0 {
+			fmt.Printf("Year:        %d\n", m.Year())
+		}
+	}
+	if b := unit.Broadcast; b != nil {
+		for _, field := range b.fields(format.SampleRate) {
+			fmt.Printf("%-12s %s\n", field[0]+":", field[1])
+		}
+	}
+	if rg := unit.replayGain; rg.hasTrack || rg.hasAlbum {
+		if rg.hasTrack {
+			fmt.Printf("Track gain:  %+.2f dB\n", rg.trackGain)
+		}
+		if rg.hasAlbum {
+			fmt.Printf("Album gain:  %+.2f dB\n", rg.albumGain)
+		}
+	}
+	return nil
+}
+
+// Export the region between --from and --to of FILE as a WAV file
+func cliClip(args []string) error {
+	fs := flag.NewFlagSet("clip", flag.ContinueOnError)
+	fromFlag := fs.String("from", "0", "start of the clip, e.g. 1:23")
+	toFlag := fs.String("to", "", "end of the clip, the end of the file when empty")
+	output := fs.String("o", "", "output WAV file")
+	positional, err := parseCLIArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return errUsage
+	}
+	unit, closeFile, err := openCLIFile(positional)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+
+	total := unit.streamer.Len()
+	fromTime, err := parseTimestamp(*fromFlag)
+	if err != nil {
+		return err
+	}
+	from, to := min(unit.format.SampleRate.N(fromTime), total), total
+	if *toFlag != "" {
+		toTime, err := parseTimestamp(*toFlag)
+		if err != nil {
+			return err
+		}
+		to = min(unit.format.SampleRate.N(toTime), total)
+	}
+	if to <= from {
+		return fmt.Errorf("clip is empty, --to must be after --from (file is %s long)", formatDuration(unit.format.SampleRate.D(total)))
+	}
+
+	out, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := unit.exportClip(out, from, to); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// Render the waveform of the whole FILE as a PNG or SVG depending on the output extension
+func cliWaveform(args []string) error {
+	fs := flag.NewFlagSet("waveform", flag.ContinueOnError)
+	size := fs.String("size", "1600x400", "image size as WIDTHxHEIGHT")
+	output := fs.String("o", "", "output PNG or SVG file")
+	positional, err := parseCLIArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *output == "" {
+		return errUsage
+	}
+	width, height, err := parseExportSize(*size)
+	if err != nil {
+		return err
+	}
+	unit, closeFile, err := openCLIFile(positional)
+	if err != nil {
+		return err
+	}
+	defer closeFile()
+
+	cols, err := unit.waveformColumns(width)
+	if err != nil {
+		return err
+	}
+	out, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(filepath.Ext(*output), "."+exportSVG) {
+		err = writeWaveformSVG(out, cols, width, height)
+	} else {
+		err = writeWaveformPNG(out, cols, width, height)
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+
+	"gioui.org/app"
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/wav"
+)
+
+// Selected clip region in samples of the current unit's stream, clipStart == clipEnd means no selection
+var clipStart, clipEnd int
+var isSelectingClip bool
+
+func hasClipSelection() bool {
+	return clipEnd > clipStart
+}
+
+func clearClipSelection() {
+	clipStart, clipEnd = 0, 0
+	isSelectingClip = false
+}
+
+// Normalize the selection after dragging so clipStart is always before clipEnd
+func finishClipSelection() {
+	isSelectingClip = false
+	clipStart, clipEnd = min(clipStart, clipEnd), max(clipStart, clipEnd)
+}
+
+// Return the sample of the current unit's stream at ratio of the track (0.0 to 1.0), clamped to the stream
+func clipSampleAt(ratio float32) int {
+	unit := currentUnit()
+	if unit == nil {
+		return 0
+	}
+	total := unit.streamer.Len()
+	return min(max(int(math.Round(float64(ratio)*float64(total))), 0), total)
+}
+
+// Return the selection as ratios of the track for drawing it
+func clipRatios() (start, end float32) {
+	unit := currentUnit()
+	if unit == nil || unit.streamer.Len() <= 0 {
+		return 0, 0
+	}
+	total := float64(unit.streamer.Len())
+	return float32(float64(clipStart) / total), float32(float64(clipEnd) / total)
+}
+
+// Clamp the selected samples into a [from, to) sample range of the unit's stream
+func (p *playbackUnit) clipRange(start, end int) (from, to int) {
+	total := p.streamer.Len()
+	from = min(max(start, 0), total)
+	to = min(max(end, from), total)
+	return from, to
+}
+
+// Encode samples [from, to) of the unit's source as a WAV file keeping the source sample rate
+func (p *playbackUnit) exportClip(w io.Writer, from, to int) error {
+	if p == nil {
+		return fmt.Errorf("exportClip: playbackUnit was nil")
+	}
+	if to <= from {
+		return fmt.Errorf("exportClip: empty range %d-%d", from, to)
+	}
+
+	// Decode independently so the playing streamer isn't disturbed
+	decoder, format, err := p.openDecoder()
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	if err := decoder.Seek(from); err != nil {
+		return fmt.Errorf("exportClip: seek failed: %w", err)
+	}
+
+	// wav encoder only supports 8, 16 or 24 bit output, keep 24 bits of 32 bit and float sources
+	if format.Precision > 3 {
+		format.Precision = 3
+	} else if format.Precision < 1 {
+		format.Precision = 2
+	}
+
+	// wav.Encode needs to seek back to finalize the header, buffer in memory if w can't
+	if ws, ok := w.(io.WriteSeeker); ok {
+		return wav.Encode(ws, beep.Take(to-from, decoder), format)
+	}
+	buf := &memWriteSeeker{}
+	if err := wav.Encode(buf, beep.Take(to-from, decoder), format); err != nil {
+		return err
+	}
+	_, err = w.Write(buf.data)
+	return err
+}
+
+// Ask for a destination file and export the current selection to it
+func exportClipDialog(w *app.Window) {
+	unit := currentUnit()
+	if unit == nil || !hasClipSelection() {
+		log.Println("exportClipDialog: nothing selected")
+		return
+	}
+	if fileDialog == nil {
+		return
+	}
+	from, to := unit.clipRange(clipStart, clipEnd)
+
+	writer, err := fileDialog.CreateFile("clip.wav")
+	if err != nil {
+		log.Println("Error creating clip file:", err)
+		return
+	}
+	defer writer.Close()
+
+	if err := unit.exportClip(writer, from, to); err != nil {
+		log.Println("Clip export failed:", err)
+		return
+	}
+	log.Printf("Exported clip %v - %v", unit.format.SampleRate.D(from), unit.format.SampleRate.D(to))
+	w.Invalidate()
+}
+
+// memWriteSeeker is an in-memory io.WriteSeeker for writers that can't seek (e.g. browser downloads)
+type memWriteSeeker struct {
+	data []byte
+	pos  int
+}
+
+func (m *memWriteSeeker) Write(p []byte) (n int, err error) {
+	if end := m.pos + len(p); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+	n = copy(m.data[m.pos:], p)
+	m.pos += n
+	return n, nil
+}
+
+func (m *memWriteSeeker) Seek(offset int64, whence int) (int64, error) {
+	var newPos int64
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = int64(m.pos) + offset
+	case io.SeekEnd:
+		newPos = int64(len(m.data)) + offset
+	default:
+		return 0, fmt.Errorf("memWriteSeeker: invalid whence %d", whence)
+	}
+	if newPos < 0 {
+		return 0, fmt.Errorf("memWriteSeeker: negative position")
+	}
+	m.pos = int(newPos)
+	return newPos, nil
+}
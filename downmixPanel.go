@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"strings"
+	"sync"
+
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"quickClip/player"
+)
+
+var showDownmix widget.Bool
+var downmixResetButton widget.Clickable
+
+// Downmix matrices edited in the panel by channel layout (see downmixKey), applied to every new playbackUnit
+// with that layout, layouts without one use the ITU downmix
+var downmixMatrices = map[string]player.Matrix{}
+var downmixMu sync.Mutex // guards downmixMatrices, which is read while loading units in the background
+
+// downmixChannelControls are the left and right gain sliders of one channel in the downmix panel
+type downmixChannelControls struct {
+	left, right widget.Float
+}
+
+var downmixControls []downmixChannelControls
+var downmixControlsKey string // layout the controls were created for
+
+func downmixKey(channels []player.Channel) string {
+	return fmt.Sprint(channels)
+}
+
+// Return the unit's downmix, nil unless it's decoded by one of our decoders (e.g. WAV, AIFF or ALAC)
+func (p *playbackUnit) downmix() *player.Downmix {
+	if p == nil {
+		return nil
+	}
+	d, _ := p.streamer.(*player.Downmix)
+	return d
+}
+
+// Return true if the unit has more than two channels to downmix, e.g. a 5.1 WAV
+func (p *playbackUnit) isMultichannel() bool {
+	d := p.downmix()
+	return d != nil && len(d.Channels()) > 2
+}
+
+// Apply the matrix edited for the unit's channel layout, or the ITU downmix if there is none
+func (p *playbackUnit) applyDownmix() {
+	d := p.downmix()
+	if d == nil {
+		return
+	}
+	channels := d.Channels()
+	downmixMu.Lock()
+	m, ok := downmixMatrices[downmixKey(channels)]
+	downmixMu.Unlock()
+	if !ok {
+		m = player.ITUDownmix(channels)
+	}
+	if err := d.SetMatrix(m); err != nil {
+		log.Println("Couldn't apply downmix:", err)
+	}
+}
+
+// Name the channel for labels, with its track name from the iXML chunk if there is one, e.g. "3 C (Boom)"
+func (p *playbackUnit) channelLabel(i int, channel player.Channel) string {
+	label := fmt.Sprintf("%d %v", i+1, channel)
+	if p.Broadcast != nil && i < len(p.Broadcast.Tracks) && p.Broadcast.Tracks[i] != "" {
+		label += " (" + p.Broadcast.Tracks[i] + ")"
+	}
+	return label
+}
+
+// Move the sliders to the matrix
+func syncDownmixSliders(m player.Matrix) {
+	for i := range downmixControls {
+		downmixControls[i].left.Value = float32(m[i][0])
+		downmixControls[i].right.Value = float32(m[i][1])
+	}
+}
+
+// Handle input of the downmix panel for the current unit, returns true if the matrix for its layout changed
+func updateDownmix(gtx layout.Context) bool {
+	d := currentUnit().downmix()
+	if d == nil {
+		return false
+	}
+	channels := d.Channels()
+	key := downmixKey(channels)
+	if key != downmixControlsKey { // loaded a file with another layout
+		downmixControlsKey = key
+		downmixControls = make([]downmixChannelControls, len(channels))
+		syncDownmixSliders(d.Matrix())
+	}
+
+	downmixMu.Lock()
+	defer downmixMu.Unlock()
+	if downmixResetButton.Clicked(gtx) {
+		delete(downmixMatrices, key)
+		syncDownmixSliders(player.ITUDownmix(channels))
+		return true
+	}
+	changed := false
+	for i := range downmixControls {
+		c := &downmixControls[i]
+		if c.left.Update(gtx) || c.right.Update(gtx) {
+			changed = true
+		}
+	}
+	if changed {
+		m := make(player.Matrix, len(downmixControls))
+		for i, c := range downmixControls {
+			m[i] = [2]float64{float64(c.left.Value), float64(c.right.Value)}
+		}
+		downmixMatrices[key] = m
+	}
+	return changed
+}
+
+// Draw the downmix panel with a left and right gain slider for every channel of the current unit
+func renderDownmix(gtx layout.Context, th *material.Theme) layout.Dimensions {
+	p := currentUnit()
+	d := p.downmix()
+	if d == nil || len(downmixControls) != len(d.Channels()) {
+		return layout.Dimensions{}
+	}
+	paint.Fill(gtx.Ops, color.NRGBA{R: 0, G: 0, B: 0, A: 180})
+	const width = 560
+	height := 64 + 36*len(downmixControls)
+	return layout.Center.Layout(gtx, func(gtx C) D {
+		size := image.Pt(gtx.Dp(width), gtx.Dp(unit.Dp(height)))
+		rect := clip.RRect{
+			Rect: image.Rectangle{Max: size},
+			SE:   gtx.Dp(12), SW: gtx.Dp(12),
+			NE: gtx.Dp(12), NW: gtx.Dp(12),
+		}
+		paint.FillShape(gtx.Ops, th.Bg, rect.Op(gtx.Ops))
+		gtx.Constraints = layout.Exact(size)
+
+		return layout.Inset{
+			Top:    unit.Dp(12),
+			Bottom: unit.Dp(12),
+			Left:   unit.Dp(16),
+			Right:  unit.Dp(16),
+		}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			var names []string
+			for _, channel := range d.Channels() {
+				names = append(names, channel.String())
+			}
+			children := []layout.FlexChild{
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Flexed(1, material.Body1(th, "Downmix to stereo: "+strings.Join(names, " ")).Layout),
+						layout.Rigid(material.Button(th, &downmixResetButton, "ITU").Layout),
+					)
+				}),
+				layout.Rigid(layout.Spacer{Height: itemSpacing}.Layout),
+			}
+			for i, channel := range d.Channels() {
+				children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return renderDownmixChannel(gtx, th, &downmixControls[i], p.channelLabel(i, channel))
+				}))
+			}
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+		})
+	})
+}
+
+// Draw the label and gain sliders of one channel
+func renderDownmixChannel(gtx layout.Context, th *material.Theme, c *downmixChannelControls, name string) layout.Dimensions {
+	label := func(text string, w unit.Dp) layout.FlexChild {
+		return layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min.X = gtx.Dp(w)
+			gtx.Constraints.Max.X = gtx.Dp(w)
+			return material.Body2(th, text).Layout(gtx)
+		})
+	}
+	return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+		label(name, 130),
+		label(fmt.Sprintf("L %.2f", c.left.Value), 60),
+		layout.Flexed(1, material.Slider(th, &c.left).Layout),
+		label(fmt.Sprintf(" R %.2f", c.right.Value), 60),
+		layout.Flexed(1, material.Slider(th, &c.right).Layout),
+	)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+const eqPlotMinFreq, eqPlotMaxFreq = 20.0, 20000.0
+const eqPlotRange = 18.0 // dB above and below 0 shown in the response plot
+
+var showEqualizer widget.Bool
+var eqEnabled widget.Bool
+var eqPreset widget.Enum // one of the eqPresets keys, empty after editing a band
+
+var eqBands = eqPresets["flat"] // bands edited in the panel, copied to the playbackSettings
+
+// eqBandControls are the widgets of one band in the equalizer panel
+type eqBandControls struct {
+	typeButton    widget.Clickable
+	freq, gain, q widget.Float // see eqBandFromSliders
+}
+
+var eqControls [eqBandCount]eqBandControls
+
+// Move the sliders of every band to its settings
+func syncEqSliders() {
+	for i, band := range eqBands {
+		c := &eqControls[i]
+		c.freq.Value = float32(math.Log(band.Freq/eqPlotMinFreq) / math.Log(eqPlotMaxFreq/eqPlotMinFreq))
+		c.gain.Value = float32(band.Gain/(2*eqMaxGain) + 0.5)
+		c.q.Value = float32(math.Log10(band.Q*10) / 2) // 0.1 to 10
+	}
+}
+
+// Read the settings of band i back from its sliders
+func eqBandFromSliders(i int) eqBand {
+	c := &eqControls[i]
+	return eqBand{
+		Type: eqBands[i].Type,
+		Freq: eqPlotMinFreq * math.Pow(eqPlotMaxFreq/eqPlotMinFreq, float64(c.freq.Value)),
+		Gain: math.Round((float64(c.gain.Value)-0.5)*2*eqMaxGain*2) / 2, // 0.5 dB steps
+		Q:    0.1 * math.Pow(100, float64(c.q.Value)),
+	}
+}
+
+// Handle input of the equalizer panel, returns true if the bands changed
+func updateEqualizer(gtx layout.Context) bool {
+	changed := eqEnabled.Update(gtx)
+	if eqPreset.Update(gtx) {
+		if preset, ok := eqPresets[eqPreset.Value]; ok {
+			eqBands = preset
+			syncEqSliders()
+			changed = true
+		}
+	}
+	for i := range eqControls {
+		c := &eqControls[i]
+		edited := false
+		if c.typeButton.Clicked(gtx) {
+			eqBands[i].Type = (eqBands[i].Type + 1) % eqBandTypes
+			edited = true
+		}
+		if c.freq.Update(gtx) || c.gain.Update(gtx) || c.q.Update(gtx) {
+			eqBands[i] = eqBandFromSliders(i)
+			edited = true
+		}
+		if edited {
+			eqPreset.Value = "" // no longer matches a preset
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Draw the equalizer panel with the combined response, presets and band controls
+func renderEqualizer(gtx layout.Context, th *material.Theme) layout.Dimensions {
+	paint.Fill(gtx.Ops, color.NRGBA{R: 0, G: 0, B: 0, A: 180})
+	const width = 560
+	const height = 380
+	return layout.Center.Layout(gtx, func(gtx C) D {
+		size := image.Pt(gtx.Dp(width), gtx.Dp(height))
+		rect := clip.RRect{
+			Rect: image.Rectangle{Max: size},
+			SE:   gtx.Dp(12), SW: gtx.Dp(12),
+			NE: gtx.Dp(12), NW: gtx.Dp(12),
+		}
+		paint.FillShape(gtx.Ops, th.Bg, rect.Op(gtx.Ops))
+		gtx.Constraints = layout.Exact(size)
+
+		return layout.Inset{
+			Top:    unit.Dp(12),
+			Bottom: unit.Dp(12),
+			Left:   unit.Dp(16),
+			Right:  unit.Dp(16),
+		}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
+			return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(material.CheckBox(th, &eqEnabled, "Equalizer").Layout),
+						layout.Rigid(material.RadioButton(th, &eqPreset, "flat", "Flat").Layout),
+						layout.Rigid(material.RadioButton(th, &eqPreset, "bass", "Bass").Layout),
+						layout.Rigid(material.RadioButton(th, &eqPreset, "treble", "Treble").Layout),
+						layout.Rigid(material.RadioButton(th, &eqPreset, "vocal", "Vocal").Layout),
+						layout.Rigid(material.RadioButton(th, &eqPreset, "loudness", "Loudness").Layout),
+					)
+				}),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					return renderEqResponse(gtx, th, image.Pt(gtx.Constraints.Max.X, gtx.Dp(120)))
+				}),
+				layout.Rigid(layout.Spacer{Height: itemSpacing}.Layout),
+				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+					children := make([]layout.FlexChild, 0, eqBandCount)
+					for i := range eqControls {
+						children = append(children, layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							return renderEqBand(gtx, th, i)
+						}))
+					}
+					return layout.Flex{Axis: layout.Vertical}.Layout(gtx, children...)
+				}),
+			)
+		})
+	})
+}
+
+// Draw the type button and freq/gain/Q sliders of band i
+func renderEqBand(gtx layout.Context, th *material.Theme, i int) layout.Dimensions {
+	band, c := eqBands[i], &eqControls[i]
+	label := func(text string, w unit.Dp) layout.FlexChild {
+		return layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min.X = gtx.Dp(w)
+			return material.Body2(th, text).Layout(gtx)
+		})
+	}
+	return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+		layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+			gtx.Constraints.Min.X = gtx.Dp(100)
+			gtx.Constraints.Max.X = gtx.Dp(100)
+			btn := material.Button(th, &c.typeButton, band.Type.String())
+			btn.TextSize = unit.Sp(12)
+			btn.Inset = layout.UniformInset(unit.Dp(4))
+			return btn.Layout(gtx)
+		}),
+		label(fmt.Sprintf(" %5.0fHz", band.Freq), 70),
+		layout.Flexed(1, material.Slider(th, &c.freq).Layout),
+		label(fmt.Sprintf(" %+5.1fdB", band.Gain), 70),
+		layout.Flexed(1, material.Slider(th, &c.gain).Layout),
+		label(fmt.Sprintf(" Q%4.1f", band.Q), 50),
+		layout.Flexed(0.6, material.Slider(th, &c.q).Layout),
+	)
+}
+
+// Plot the combined frequency response of the bands on a log frequency axis
+func renderEqResponse(gtx layout.Context, th *material.Theme, size image.Point) layout.Dimensions {
+	paint.FillShape(gtx.Ops, color.NRGBA{R: 20, G: 20, B: 20, A: 255}, clip.Rect{Max: size}.Op())
+
+	w, h := float32(size.X), float32(size.Y)
+	freqX := func(freq float64) float32 {
+		return float32(math.Log(freq/eqPlotMinFreq)/math.Log(eqPlotMaxFreq/eqPlotMinFreq)) * w
+	}
+	dbY := func(db float64) float32 {
+		db = min(max(db, -eqPlotRange), eqPlotRange)
+		return float32(0.5-db/(2*eqPlotRange)) * h
+	}
+
+	// Grid lines every 6 dB and at 100 Hz, 1 kHz and 10 kHz
+	gridColor := color.NRGBA{R: 70, G: 70, B: 70, A: 255}
+	for db := -12.0; db <= 12; db += 6 {
+		y := int(dbY(db))
+		paint.FillShape(gtx.Ops, gridColor, clip.Rect{Min: image.Pt(0, y), Max: image.Pt(size.X, y+1)}.Op())
+	}
+	for _, freq := range []float64{100, 1000, 10000} {
+		x := int(freqX(freq))
+		paint.FillShape(gtx.Ops, gridColor, clip.Rect{Min: image.Pt(x, 0), Max: image.Pt(x+1, size.Y)}.Op())
+	}
+
+	var path clip.Path
+	path.Begin(gtx.Ops)
+	sampleRate := float64(globalSampleRate)
+	for x := 0; x <= size.X; x += 2 {
+		freq := eqPlotMinFreq * math.Pow(eqPlotMaxFreq/eqPlotMinFreq, float64(x)/float64(size.X))
+		point := f32.Pt(float32(x), dbY(eqResponse(eqBands[:], freq, sampleRate)))
+		if x == 0 {
+			path.MoveTo(point)
+		} else {
+			path.LineTo(point)
+		}
+	}
+	curveColor := waveformColor1
+	if !eqEnabled.Value {
+		curveColor = color.NRGBA{R: 120, G: 120, B: 120, A: 255}
+	}
+	paint.FillShape(gtx.Ops, curveColor, clip.Stroke{Path: path.End(), Width: 2}.Op())
+
+	label := material.Caption(th, fmt.Sprintf("±%.0f dB", eqPlotRange))
+	label.Color = color.NRGBA{R: 150, G: 150, B: 150, A: 255}
+	label.Layout(gtx)
+	return layout.Dimensions{Size: size}
+}
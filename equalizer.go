@@ -0,0 +1,223 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/speaker"
+)
+
+const eqBandCount = 5
+const eqMaxGain = 15.0 // dB of boost or cut per band
+
+// eqBandType is the filter shape of an equalizer band
+type eqBandType int
+
+const (
+	eqOff eqBandType = iota
+	eqPeak
+	eqLowShelf
+	eqHighShelf
+	eqLowPass
+	eqHighPass
+	eqBandTypes // number of band types
+)
+
+func (t eqBandType) String() string {
+	switch t {
+	case eqPeak:
+		return "Peak"
+	case eqLowShelf:
+		return "Low Shelf"
+	case eqHighShelf:
+		return "High Shelf"
+	case eqLowPass:
+		return "Low Pass"
+	case eqHighPass:
+		return "High Pass"
+	default:
+		return "Off"
+	}
+}
+
+// eqBand is a single filter of the equalizer, Gain is ignored by the pass filters
+type eqBand struct {
+	Type eqBandType
+	Freq float64 // center or corner frequency in Hz
+	Gain float64 // dB
+	Q    float64
+}
+
+// biquad holds normalized filter coefficients (a0 == 1)
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// Filter coefficients of the band at sampleRate, after the RBJ audio EQ cookbook
+func (b eqBand) biquad(sampleRate float64) biquad {
+	freq := min(max(b.Freq, 10), sampleRate*0.49)
+	q := max(b.Q, 0.05)
+	a := math.Pow(10, b.Gain/40)
+	w0 := 2 * math.Pi * freq / sampleRate
+	cos, alpha := math.Cos(w0), math.Sin(w0)/(2*q)
+	shelf := 2 * math.Sqrt(a) * alpha
+
+	var b0, b1, b2, a0, a1, a2 float64
+	switch b.Type {
+	case eqPeak:
+		b0, b1, b2 = 1+alpha*a, -2*cos, 1-alpha*a
+		a0, a1, a2 = 1+alpha/a, -2*cos, 1-alpha/a
+	case eqLowShelf:
+		b0 = a * ((a + 1) - (a-1)*cos + shelf)
+		b1 = 2 * a * ((a - 1) - (a+1)*cos)
+		b2 = a * ((a + 1) - (a-1)*cos - shelf)
+		a0 = (a + 1) + (a-1)*cos + shelf
+		a1 = -2 * ((a - 1) + (a+1)*cos)
+		a2 = (a + 1) + (a-1)*cos - shelf
+	case eqHighShelf:
+		b0 = a * ((a + 1) + (a-1)*cos + shelf)
+		b1 = -2 * a * ((a - 1) + (a+1)*cos)
+		b2 = a * ((a + 1) + (a-1)*cos - shelf)
+		a0 = (a + 1) - (a-1)*cos + shelf
+		a1 = 2 * ((a - 1) - (a+1)*cos)
+		a2 = (a + 1) - (a-1)*cos - shelf
+	case eqLowPass:
+		b0, b1, b2 = (1-cos)/2, 1-cos, (1-cos)/2
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	case eqHighPass:
+		b0, b1, b2 = (1+cos)/2, -(1 + cos), (1+cos)/2
+		a0, a1, a2 = 1+alpha, -2*cos, 1-alpha
+	default:
+		return biquad{b0: 1}
+	}
+	return biquad{b0: b0 / a0, b1: b1 / a0, b2: b2 / a0, a1: a1 / a0, a2: a2 / a0}
+}
+
+// Return whether the band changes the sound at all
+func (b eqBand) active() bool {
+	switch b.Type {
+	case eqOff:
+		return false
+	case eqPeak, eqLowShelf, eqHighShelf:
+		return b.Gain != 0
+	}
+	return true
+}
+
+// Filter a single sample, state is the transposed direct form II delay of the channel
+func (f biquad) process(x float64, state *[2]float64) float64 {
+	y := f.b0*x + state[0]
+	state[0] = f.b1*x - f.a1*y + state[1]
+	state[1] = f.b2*x - f.a2*y
+	return y
+}
+
+// Magnitude response in dB of the filter at freq
+func (f biquad) response(freq, sampleRate float64) float64 {
+	z := cmplx.Exp(complex(0, -2*math.Pi*freq/sampleRate))
+	h := (complex(f.b0, 0) + complex(f.b1, 0)*z + complex(f.b2, 0)*z*z) /
+		(1 + complex(f.a1, 0)*z + complex(f.a2, 0)*z*z)
+	return 20 * math.Log10(max(cmplx.Abs(h), 1e-9))
+}
+
+// Combined magnitude response in dB of bands at freq
+func eqResponse(bands []eqBand, freq, sampleRate float64) float64 {
+	var db float64
+	for _, band := range bands {
+		if band.active() {
+			db += band.biquad(sampleRate).response(freq, sampleRate)
+		}
+	}
+	return db
+}
+
+var eqPresets = map[string][eqBandCount]eqBand{
+	"flat": {
+		{Type: eqLowShelf, Freq: 100, Q: 0.7},
+		{Type: eqPeak, Freq: 300, Q: 1},
+		{Type: eqPeak, Freq: 1000, Q: 1},
+		{Type: eqPeak, Freq: 3000, Q: 1},
+		{Type: eqHighShelf, Freq: 8000, Q: 0.7},
+	},
+	"bass": {
+		{Type: eqLowShelf, Freq: 100, Gain: 6, Q: 0.7},
+		{Type: eqPeak, Freq: 250, Gain: 2, Q: 1},
+		{Type: eqPeak, Freq: 1000, Q: 1},
+		{Type: eqPeak, Freq: 3000, Q: 1},
+		{Type: eqHighShelf, Freq: 8000, Q: 0.7},
+	},
+	"treble": {
+		{Type: eqLowShelf, Freq: 100, Q: 0.7},
+		{Type: eqPeak, Freq: 300, Q: 1},
+		{Type: eqPeak, Freq: 1000, Q: 1},
+		{Type: eqPeak, Freq: 4000, Gain: 2, Q: 1},
+		{Type: eqHighShelf, Freq: 8000, Gain: 6, Q: 0.7},
+	},
+	"vocal": { // less rumble and mud, more presence
+		{Type: eqHighPass, Freq: 80, Q: 0.7},
+		{Type: eqPeak, Freq: 250, Gain: -3, Q: 1},
+		{Type: eqPeak, Freq: 1000, Q: 1},
+		{Type: eqPeak, Freq: 3000, Gain: 4, Q: 1.2},
+		{Type: eqHighShelf, Freq: 10000, Gain: 1, Q: 0.7},
+	},
+	"loudness": { // boosted lows and highs for quiet listening
+		{Type: eqLowShelf, Freq: 80, Gain: 7, Q: 0.7},
+		{Type: eqPeak, Freq: 300, Q: 1},
+		{Type: eqPeak, Freq: 1000, Gain: -2, Q: 0.8},
+		{Type: eqPeak, Freq: 3000, Q: 1},
+		{Type: eqHighShelf, Freq: 10000, Gain: 5, Q: 0.7},
+	},
+}
+
+// parametricEQ filters the stream through a chain of biquad filters, one per active band
+type parametricEQ struct {
+	s          beep.Streamer
+	sampleRate float64
+	filters    []biquad
+	state      [][2][2]float64 // delay per filter and channel, see biquad.process
+}
+
+func newParametricEQ(s beep.Streamer, sampleRate beep.SampleRate) *parametricEQ {
+	return &parametricEQ{s: s, sampleRate: float64(sampleRate)}
+}
+
+// Replace the bands, filter state is kept where possible so changes don't click
+func (e *parametricEQ) setBands(bands []eqBand) {
+	e.filters = e.filters[:0]
+	for _, band := range bands {
+		if band.active() {
+			e.filters = append(e.filters, band.biquad(e.sampleRate))
+		}
+	}
+	for len(e.state) < len(e.filters) {
+		e.state = append(e.state, [2][2]float64{})
+	}
+	e.state = e.state[:len(e.filters)]
+}
+
+func (e *parametricEQ) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = e.s.Stream(samples)
+	for i, f := range e.filters {
+		state := &e.state[i]
+		for j := range samples[:n] {
+			samples[j][0] = f.process(samples[j][0], &state[0])
+			samples[j][1] = f.process(samples[j][1], &state[1])
+		}
+	}
+	return n, ok
+}
+
+func (e *parametricEQ) Err() error {
+	return e.s.Err()
+}
+
+// Apply the equalizer bands to the unit, nil bands turn the equalizer off
+func (p *playbackUnit) setEqualizer(bands []eqBand) {
+	if p == nil {
+		return
+	}
+	speaker.Lock()
+	p.eq.setBands(bands)
+	speaker.Unlock()
+}
@@ -7,6 +7,7 @@ require (
 	gioui.org/x v0.10.1
 	github.com/dhowden/tag v0.0.0-20240417053706-3d75831295e8
 	github.com/gopxl/beep/v2 v2.1.1
+	github.com/pion/opus v0.1.0
 	golang.org/x/image v0.41.0
 )
 
@@ -19,6 +20,8 @@ require (
 	github.com/godbus/dbus/v5 v5.0.6 // indirect
 	github.com/hajimehoshi/go-mp3 v0.3.4 // indirect
 	github.com/icza/bitio v1.1.0 // indirect
+	github.com/jfreymuth/oggvorbis v1.0.5 // indirect
+	github.com/jfreymuth/vorbis v1.0.2 // indirect
 	github.com/mewkiz/flac v1.0.12 // indirect
 	github.com/mewkiz/pkg v0.0.0-20241223220703-7f3c7df797ff // indirect
 	github.com/mewpkg/term v0.0.0-20241026122259-37a80af23985 // indirect
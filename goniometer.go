@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget/material"
+)
+
+const goniometerSize = 256    // resolution of the scope image
+const goniometerFrames = 2048 // latest frames plotted every frame
+const goniometerDecay = 0.75  // how much of the previous image is kept, like phosphor afterglow
+
+// goniometer plots left against right rotated by 45° so mono is a vertical line and out of phase is horizontal
+type goniometer struct {
+	img          *image.NRGBA
+	frames       [][2]float32
+	correlation  float64 // smoothed phase correlation from -1 (out of phase) to 1 (mono)
+	lastWritePos int
+}
+
+var scope = &goniometer{
+	img:          image.NewNRGBA(image.Rect(0, 0, goniometerSize, goniometerSize)),
+	frames:       make([][2]float32, goniometerFrames),
+	lastWritePos: -1,
+}
+
+// Fade the image and plot the latest played frames
+func (g *goniometer) update() {
+	if audio.Ring().Written() == g.lastWritePos { // no new audio (e.g. paused)
+		return
+	}
+	g.lastWritePos = audio.Ring().Written()
+
+	for i := 3; i < len(g.img.Pix); i += 4 {
+		g.img.Pix[i] = uint8(float64(g.img.Pix[i]) * goniometerDecay)
+	}
+
+	audio.Ring().ReadFrames(g.frames)
+	var sumLR, sumLL, sumRR float64
+	dotColor := waveformColor1
+	half := float64(goniometerSize) / 2
+	for _, frame := range g.frames {
+		left, right := float64(frame[0]), float64(frame[1])
+		sumLR += left * right
+		sumLL += left * left
+		sumRR += right * right
+
+		side, mid := (left-right)/math.Sqrt2, (left+right)/math.Sqrt2
+		x := int(half - side*half) // left only signals lean to the upper left
+		y := int(half - mid*half)
+		if x < 0 || y < 0 || x >= goniometerSize || y >= goniometerSize {
+			continue
+		}
+		pixel := g.img.PixOffset(x, y)
+		g.img.Pix[pixel], g.img.Pix[pixel+1], g.img.Pix[pixel+2] = dotColor.R, dotColor.G, dotColor.B
+		g.img.Pix[pixel+3] = uint8(min(int(g.img.Pix[pixel+3])+96, 255))
+	}
+
+	correlation := 0.0
+	if sumLL > 0 && sumRR > 0 {
+		correlation = sumLR / math.Sqrt(sumLL*sumRR)
+	}
+	g.correlation = g.correlation*0.8 + correlation*0.2
+}
+
+func (g *goniometer) reset() {
+	clear(g.img.Pix)
+	g.correlation = 0
+	g.lastWritePos = -1
+}
+
+// Draw the goniometer as a square in the middle and the correlation meter below it
+func renderGoniometer(gtx layout.Context, th *material.Theme, width, height int) layout.Dimensions {
+	scope.update()
+	meterHeight := gtx.Dp(unit.Dp(24))
+	size := max(min(width, height-meterHeight), 0)
+	left := (width - size) / 2
+
+	// Axes: mono (vertical), out of phase (horizontal) and the left/right diagonals
+	axisColor := color.NRGBA{R: 255, G: 255, B: 255, A: 30}
+	paint.FillShape(gtx.Ops, axisColor, clip.Rect{Min: image.Pt(left+size/2, 0), Max: image.Pt(left+size/2+1, size)}.Op())
+	paint.FillShape(gtx.Ops, axisColor, clip.Rect{Min: image.Pt(left, size/2), Max: image.Pt(left+size, size/2+1)}.Op())
+	for _, axis := range []struct {
+		label string
+		x, y  int
+	}{{"M", left + size/2 + 2, 0}, {"L", left + size/8, size / 8}, {"R", left + size*7/8 - gtx.Dp(10), size / 8}, {"S", left + size - gtx.Dp(12), size / 2}} {
+		offset := op.Offset(image.Pt(axis.x, axis.y)).Push(gtx.Ops)
+		label := material.Caption(th, axis.label)
+		label.Color = color.NRGBA{R: 255, G: 255, B: 255, A: 120}
+		labelGtx := gtx
+		labelGtx.Constraints.Min = image.Point{}
+		label.Layout(labelGtx)
+		offset.Pop()
+	}
+
+	offset := op.Offset(image.Pt(left, 0)).Push(gtx.Ops)
+	imgOp := paint.NewImageOp(scope.img)
+	imgOp.Filter = paint.FilterLinear
+	drawImageScaled(gtx, imgOp, size, size)
+	offset.Pop()
+
+	renderCorrelation(gtx, th, image.Rect(left, height-meterHeight, left+size, height), scope.correlation)
+	return layout.Dimensions{Size: image.Point{X: width, Y: height}}
+}
+
+// Draw a correlation meter from -1 (left edge) to +1 (right edge) within bounds, negative values are drawn in red
+func renderCorrelation(gtx layout.Context, th *material.Theme, bounds image.Rectangle, correlation float64) {
+	barTop := bounds.Min.Y + bounds.Dy()/2
+	paint.FillShape(gtx.Ops, color.NRGBA{R: 50, G: 50, B: 50, A: 255},
+		clip.Rect{Min: image.Pt(bounds.Min.X, barTop), Max: bounds.Max}.Op())
+
+	center := bounds.Min.X + bounds.Dx()/2
+	x := center + int(correlation*float64(bounds.Dx()/2))
+	barColor := color.NRGBA{R: 80, G: 220, B: 120, A: 255}
+	if correlation < 0 {
+		barColor = color.NRGBA{R: 255, G: 60, B: 60, A: 255}
+	}
+	paint.FillShape(gtx.Ops, barColor,
+		clip.Rect{Min: image.Pt(min(center, x), barTop), Max: image.Pt(max(center, x)+1, bounds.Max.Y)}.Op())
+
+	offset := op.Offset(bounds.Min).Push(gtx.Ops)
+	label := material.Caption(th, fmt.Sprintf("Correlation %+.2f", correlation))
+	label.Color = color.NRGBA{R: 220, G: 220, B: 220, A: 255}
+	labelGtx := gtx
+	labelGtx.Constraints.Min = image.Point{}
+	labelGtx.Constraints.Max.X = bounds.Dx()
+	label.Layout(labelGtx)
+	offset.Pop()
+}
@@ -1,6 +1,10 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
+
 	"gioui.org/app"
 	_ "gioui.org/font/gofont"
 	"gioui.org/font/opentype"
@@ -17,20 +21,46 @@ import (
 	"image"
 	"image/color"
 	"log"
+	"math"
+	"quickClip/player"
+	"quickClip/player/waveformui"
 	"runtime"
+	"strconv"
+	"strings"
 )
 
 var fileDialog *explorer.Explorer
 var openButton, backButton, fwdButton, playButton, stopButton widget.Clickable
 var progressClickable widget.Clickable
+var exportClipButton, clearClipButton widget.Clickable
+var loopAButton, loopBButton, clearLoopButton widget.Clickable
 var volumeSlider widget.Float // widget state for the slider
 var playbackProgress float32
+var progressBarWidth int // width of the seek bar from the last frame, used to map pointer positions
 var isManualSeeking bool
 var manualSeekPosition float32
 var itemSpacing = unit.Dp(5)
 
 var showDialog widget.Bool
 var isHqMode widget.Bool
+var visualizerMode widget.Enum
+var crossfadeSlider widget.Float // crossfade between queued tracks, 0 to player.MaxCrossfade
+var speedSlider widget.Float     // playback speed on a log scale, see sliderSpeed
+var preservePitchToggle widget.Bool
+var loopCrossfadeToggle widget.Bool
+var normalizeEnum widget.Enum       // one of the normalizeMode values
+var normalizeTargetEnum widget.Enum // target loudness in LUFS, e.g. "-14"
+var preventClippingToggle widget.Bool
+var semitoneSlider, centSlider widget.Float // pitch shift, see sliderPitch
+
+// Values of visualizerMode
+const (
+	modeWaveform         = "waveform"
+	modeSpectrum         = "spectrum"
+	modeSpectrogram      = "spectrogram"
+	modeTrackSpectrogram = "trackSpectrogram"
+	modeGoniometer       = "goniometer"
+)
 
 type C = layout.Context
 type D = layout.Dimensions
@@ -61,27 +91,97 @@ func init() {
 	ps2.SetColor(waveformColor2)
 
 	isHqMode.Value = runtime.GOOS != "js" // Default to HQ mode on non-wasm
+	visualizerMode.Value = modeWaveform
+	waveformLayout.Value = waveformMono
+	waveformExportSize.Value = "1600x400"
+	waveformExportFormat.Value = exportPNG
+	showMeters.Value = true
+	spectrumSmoothing.Value = 0.6
+	spectrogramColormap.Value = "magma"
+	spectrogramRange.Value = "90"
+	speedSlider.Value = 0.5 // 1.0x
+	defaults := currentSettings()
+	preservePitchToggle.Value = defaults.preservePitch
+	loopCrossfadeToggle.Value = defaults.loopCrossfade
+	normalizeEnum.Value = defaults.normalize.mode
+	normalizeTargetEnum.Value = strconv.Itoa(int(defaults.normalize.target))
+	preventClippingToggle.Value = defaults.normalize.preventClipping
+	eqPreset.Value = "flat"
+	syncEqSliders()
+	semitoneSlider.Value = 0.5 // no shift
+	centSlider.Value = 0.5
 }
 
-func openFileDialog(w *app.Window) {
+// Map the speed slider from 0.5x (left) over 1.0x (middle) to 2.0x (right), snapping to 1.0x near the middle
+func sliderSpeed() float64 {
+	speed := minPlaybackSpeed * math.Pow(maxPlaybackSpeed/minPlaybackSpeed, float64(speedSlider.Value))
+	if math.Abs(speed-1) < 0.02 {
+		return 1
+	}
+	return speed
+}
+
+// Map the pitch sliders to whole semitones (-12 to +12) and cents (-50 to +50)
+func sliderPitch() (semitones, cents int) {
+	semitones = int(math.Round(float64(semitoneSlider.Value-0.5) * 2 * maxPitchSemitones))
+	cents = int(math.Round(float64(centSlider.Value-0.5) * 100))
+	return semitones, cents
+}
+
+// Supported file extensions offered by the file dialog
+var audioExtensions = []string{".wav", ".flac", ".mp3", ".ogg", ".opus", ".aiff", ".aif", ".aifc", ".m4a"}
+
+// Open file dialog for one or more audio files, falls back to a single file where multi-select is unavailable
+func chooseAudioFiles(w *app.Window) ([]io.ReadCloser, error) {
 	if fileDialog == nil {
 		fileDialog = explorer.NewExplorer(w)
 	}
 
-	// Open file dialog for a single audio file
-	reader, err := fileDialog.ChooseFile(".wav", ".flac", ".mp3")
+	readers, err := chooseBrowserFiles(audioExtensions...)
+	if errors.Is(err, explorer.ErrNotAvailable) {
+		readers, err = fileDialog.ChooseFiles(audioExtensions...)
+	}
+	if errors.Is(err, explorer.ErrNotAvailable) {
+		var reader io.ReadCloser
+		reader, err = fileDialog.ChooseFile(audioExtensions...)
+		readers = []io.ReadCloser{reader}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return readers, nil
+}
+
+// Replace the queue with the selected files and start playing the first one
+func openFileDialog(w *app.Window) {
+	readers, err := chooseAudioFiles(w)
 	if err != nil {
 		log.Println("Error selecting file:", err)
 		return
 	}
 
+	// Stop using the current files before the queue closes them
 	eject()
-	currentReader = reader
-	play(w) // keep playing with new reader
+	playEntry(w, queue.set(readers)) // keep playing with new reader
+}
+
+// Append the selected files to the queue, starting playback if nothing is playing
+func addFilesDialog(w *app.Window) {
+	readers, err := chooseAudioFiles(w)
+	if err != nil {
+		log.Println("Error selecting file:", err)
+		return
+	}
+
+	queue.add(readers)
+	if state := audio.State(); state == player.NotInitialized || state == player.Finished {
+		playNext(w)
+	}
+	w.Invalidate()
 }
 
-func updateProgressBar(pUnit *playbackUnit) {
-	playbackProgress = pUnit.getProgressFloat()
+func updateProgressBar() {
+	playbackProgress = audio.Progress()
 }
 
 func resetProgressBar() {
@@ -93,7 +193,7 @@ func render(gtx layout.Context, th *material.Theme, e app.FrameEvent) {
 	paint.ColorOp{Color: color.NRGBA{R: 30, G: 30, B: 30, A: 255}}.Add(gtx.Ops)
 	paint.PaintOp{}.Add(gtx.Ops)
 
-	// Outer horizontal flex: left for waveform/progress, right for buttons.
+	// Outer horizontal flex: left for waveform/progress/buttons, right for the play queue.
 	layout.Flex{
 		Axis:    layout.Horizontal,
 		Spacing: layout.SpaceStart,
@@ -105,10 +205,20 @@ func render(gtx layout.Context, th *material.Theme, e app.FrameEvent) {
 				Spacing: layout.SpaceStart,
 			}.Layout(gtx,
 				layout.Flexed(1, func(gtx C) D {
-					return layout.Stack{}.Layout(gtx,
-						layout.Expanded(func(gtx C) D {
-							return renderWaveform(gtx, gtx.Constraints.Max.X, gtx.Constraints.Max.Y)
-						}))
+					return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+						layout.Flexed(1, func(gtx C) D {
+							return layout.Stack{}.Layout(gtx,
+								layout.Expanded(func(gtx C) D {
+									return renderVisualizer(gtx, th)
+								}))
+						}),
+						layout.Rigid(func(gtx C) D {
+							if !showMeters.Value {
+								return layout.Dimensions{}
+							}
+							return renderMeters(gtx, th)
+						}),
+					)
 				}),
 				layout.Rigid(func(gtx C) D {
 					if showDialog.Value {
@@ -116,6 +226,18 @@ func render(gtx layout.Context, th *material.Theme, e app.FrameEvent) {
 					}
 					return layout.Dimensions{}
 				}),
+				layout.Rigid(func(gtx C) D {
+					if showEqualizer.Value {
+						return renderEqualizer(gtx, th)
+					}
+					return layout.Dimensions{}
+				}),
+				layout.Rigid(func(gtx C) D {
+					if showDownmix.Value && currentUnit().isMultichannel() {
+						return renderDownmix(gtx, th)
+					}
+					return layout.Dimensions{}
+				}),
 				layout.Rigid(func(gtx C) D { // Mid buttons
 					return layout.Flex{
 						Axis:    layout.Horizontal,
@@ -127,7 +249,7 @@ func render(gtx layout.Context, th *material.Theme, e app.FrameEvent) {
 						}),
 						layout.Rigid(layout.Spacer{Width: itemSpacing}.Layout),
 						layout.Rigid(func(gtx C) D {
-							if currentState == Playing {
+							if audio.State() == player.Playing {
 								return material.Button(th, &stopButton, "Stop").Layout(gtx)
 							}
 							return material.Button(th, &playButton, "Play").Layout(gtx)
@@ -141,9 +263,46 @@ func render(gtx layout.Context, th *material.Theme, e app.FrameEvent) {
 							return material.Button(th, &fwdButton, "Forward").Layout(gtx)
 						}),
 						layout.Rigid(layout.Spacer{Width: itemSpacing}.Layout),
+						layout.Rigid(func(gtx C) D {
+							return material.Button(th, &loopAButton, "A").Layout(gtx)
+						}),
+						layout.Rigid(layout.Spacer{Width: itemSpacing}.Layout),
+						layout.Rigid(func(gtx C) D {
+							return material.Button(th, &loopBButton, "B").Layout(gtx)
+						}),
+						layout.Rigid(layout.Spacer{Width: itemSpacing}.Layout),
+						layout.Rigid(func(gtx C) D {
+							if !currentUnit().hasLoopMarkers() {
+								return layout.Dimensions{}
+							}
+							return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+								layout.Rigid(material.Button(th, &clearLoopButton, "Loop Off").Layout),
+								layout.Rigid(layout.Spacer{Width: itemSpacing}.Layout),
+							)
+						}),
+						layout.Rigid(func(gtx C) D {
+							if !hasClipSelection() {
+								return layout.Dimensions{}
+							}
+							return layout.Flex{Axis: layout.Horizontal}.Layout(gtx,
+								layout.Rigid(material.Button(th, &exportClipButton, "Export Clip").Layout),
+								layout.Rigid(layout.Spacer{Width: itemSpacing}.Layout),
+								layout.Rigid(material.Button(th, &clearClipButton, "Clear").Layout),
+								layout.Rigid(layout.Spacer{Width: itemSpacing}.Layout),
+							)
+						}),
 						layout.Rigid(func(gtx C) D {
 							return material.CheckBox(th, &showDialog, "Options").Layout(gtx)
 						}),
+						layout.Rigid(func(gtx C) D {
+							return material.CheckBox(th, &showEqualizer, "EQ").Layout(gtx)
+						}),
+						layout.Rigid(func(gtx C) D {
+							if !currentUnit().isMultichannel() {
+								return layout.Dimensions{}
+							}
+							return material.CheckBox(th, &showDownmix, "Mix").Layout(gtx)
+						}),
 						layout.Rigid(func(gtx C) D {
 							slider := material.Slider(th, &volumeSlider) // Default value set in Main
 							gtx.Constraints.Min.X = gtx.Dp(150)
@@ -155,41 +314,135 @@ func render(gtx layout.Context, th *material.Theme, e app.FrameEvent) {
 				layout.Rigid(func(gtx C) D {
 					return layout.Inset{Left: unit.Dp(5), Right: unit.Dp(5), Top: unit.Dp(4), Bottom: unit.Dp(4)}.Layout(gtx, func(gtx C) D {
 						const progressBarHeight = 10
-						gtx.Constraints.Min.Y = gtx.Dp(progressBarHeight)
-						gtx.Constraints.Max.Y = gtx.Dp(progressBarHeight)
+						const overviewHeight = 48
+						progress := playbackProgress
+						if isManualSeeking {
+							progress = manualSeekPosition
+						}
+						var overview *player.Overview
+						if unit := currentUnit(); unit != nil {
+							overview = unit.overview
+						}
+
+						height := progressBarHeight
+						if overview != nil {
+							height = overviewHeight
+						}
+						gtx.Constraints.Min.Y = gtx.Dp(unit.Dp(height))
+						gtx.Constraints.Max.Y = gtx.Dp(unit.Dp(height))
+						progressBarWidth = gtx.Constraints.Max.X
 						return progressClickable.Layout(gtx, func(gtx C) D {
-							return layout.Center.Layout(gtx, func(gtx C) D {
-								gtx2 := gtx
-								gtx2.Constraints.Min.Y = gtx.Dp(progressBarHeight)
-								gtx2.Constraints.Max.Y = gtx.Dp(progressBarHeight)
-								if isManualSeeking {
-									return material.ProgressBar(th, manualSeekPosition).Layout(gtx2)
-								}
-								return material.ProgressBar(th, playbackProgress).Layout(gtx2)
-							})
+							return layout.Stack{}.Layout(gtx,
+								layout.Stacked(func(gtx C) D {
+									if overview != nil {
+										gtx.Constraints.Min = gtx.Constraints.Max
+										return waveformui.Overview(gtx, overview, progress, waveformColor1, waveformColor2)
+									}
+									return layout.Center.Layout(gtx, func(gtx C) D {
+										gtx2 := gtx
+										gtx2.Constraints.Min.Y = gtx.Dp(progressBarHeight)
+										gtx2.Constraints.Max.Y = gtx.Dp(progressBarHeight)
+										return material.ProgressBar(th, progress).Layout(gtx2)
+									})
+								}),
+								layout.Expanded(renderClipSelection),
+								layout.Expanded(renderLoopMarkers),
+							)
 						})
 					})
 				}),
 			)
 		}),
+		layout.Rigid(func(gtx C) D {
+			return renderQueue(gtx, th)
+		}),
 	)
 
 	e.Frame(gtx.Ops)
 }
 
+// Describe the measured loudness of the unit, e.g. for the options dialog
+func loudnessLabel(p *playbackUnit) string {
+	if p == nil {
+		return "Loudness: no track"
+	}
+	measured, ok := p.loudness.measured()
+	if !ok {
+		return "Loudness: measuring..."
+	}
+	return fmt.Sprintf("Loudness: %.1f LUFS, range %.1f LU, true peak %.1f dBTP",
+		measured.Integrated, measured.Range, measured.TruePeak)
+}
+
+// Describe the unit's BWF bext/iXML metadata, empty if it has none
+func broadcastLabel(p *playbackUnit) string {
+	if p == nil || p.Broadcast == nil {
+		return ""
+	}
+	var parts []string
+	for _, field := range p.Broadcast.fields(p.format.SampleRate) {
+		parts = append(parts, field[0]+": "+field[1])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Draw the visualizer selected in the options dialog
+func renderVisualizer(gtx layout.Context, th *material.Theme) layout.Dimensions {
+	width, height := gtx.Constraints.Max.X, gtx.Constraints.Max.Y
+	switch visualizerMode.Value {
+	case modeSpectrum:
+		return renderSpectrum(gtx, th, width, height)
+	case modeGoniometer:
+		return renderGoniometer(gtx, th, width, height)
+	case modeSpectrogram:
+		return renderSpectrogram(gtx, width, height)
+	case modeTrackSpectrogram:
+		unit := currentUnit()
+		if unit == nil {
+			return layout.Dimensions{}
+		}
+		progress := playbackProgress
+		if isManualSeeking {
+			progress = manualSeekPosition
+		}
+		return renderTrackSpectrogram(gtx, unit.spectrogram, progress, width, height)
+	default:
+		if d := currentUnit().downmix(); d != nil && waveformLayout.Value == waveformChannels {
+			return renderChannelWaveforms(gtx, th, currentUnit(), d, width, height)
+		}
+		return renderWaveform(gtx)
+	}
+}
+
+// Shade the selected clip region on top of the progress bar
+func renderClipSelection(gtx C) D {
+	if !isSelectingClip && !hasClipSelection() {
+		return layout.Dimensions{}
+	}
+	start, end := clipRatios()
+	width := float32(gtx.Constraints.Max.X)
+	left := int(min(start, end) * width)
+	right := int(max(start, end) * width)
+	rect := clip.Rect{Min: image.Pt(left, 0), Max: image.Pt(right, gtx.Constraints.Max.Y)}
+	paint.FillShape(gtx.Ops, color.NRGBA{R: 255, G: 200, B: 0, A: 120}, rect.Op())
+	return layout.Dimensions{Size: gtx.Constraints.Max}
+}
+
 var mState1 colorpicker.State
 var mState2 colorpicker.State
 var ps1 colorpicker.PickerStyle
 var ps2 colorpicker.PickerStyle
+var dialogList = widget.List{List: layout.List{Axis: layout.Vertical, Alignment: layout.Middle}}
 
 func renderDialog(gtx layout.Context, th *material.Theme) layout.Dimensions {
 	// Draw a semi-transparent overlay background.
 	paint.Fill(gtx.Ops, color.NRGBA{R: 0, G: 0, B: 0, A: 180})
 	const width = 500
-	const height = 270
+	const maxHeight = 720 // shorter in smaller windows, the options scroll
 	// Dialog position offset
 	return layout.Center.Layout(gtx, func(gtx C) D {
-		size := image.Pt(gtx.Dp(width), gtx.Dp(height))
+		size := image.Pt(min(gtx.Dp(width), gtx.Constraints.Max.X), min(gtx.Dp(maxHeight), gtx.Constraints.Max.Y))
+		gtx.Constraints = layout.Exact(size)
 		rect := clip.RRect{ // Rounded rectangle for the dialog.
 			Rect: image.Rectangle{Max: size},
 			SE:   gtx.Dp(12), SW: gtx.Dp(12),
@@ -204,15 +457,11 @@ func renderDialog(gtx layout.Context, th *material.Theme) layout.Dimensions {
 			Left:   unit.Dp(16),
 			Right:  unit.Dp(16),
 		}.Layout(gtx, func(gtx layout.Context) layout.Dimensions {
-			return layout.Flex{
-				Axis:      layout.Vertical,
-				Spacing:   layout.SpaceAround,
-				Alignment: layout.Middle,
-			}.Layout(gtx,
-				layout.Rigid(material.Body1(th, "Waveform Colors:").Layout),
-				layout.Rigid(layout.Spacer{Height: itemSpacing}.Layout),
+			rows := []layout.Widget{
+				material.Body1(th, "Waveform Colors:").Layout,
+				layout.Spacer{Height: itemSpacing}.Layout,
 				// Side x Side color pickers
-				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+				func(gtx layout.Context) layout.Dimensions {
 					const totalWidth = width - (16 * 2) // dialog width - left/right inset
 					return layout.Flex{
 						Axis:      layout.Horizontal,
@@ -233,12 +482,166 @@ func renderDialog(gtx layout.Context, th *material.Theme) layout.Dimensions {
 							return dims
 						}),
 					)
-				}),
-				layout.Rigid(layout.Spacer{Height: itemSpacing}.Layout),
-				layout.Rigid(func(gtx layout.Context) layout.Dimensions {
-					return material.CheckBox(th, &isHqMode, "HQ Mode").Layout(gtx)
-				}),
-			)
+				},
+				layout.Spacer{Height: itemSpacing}.Layout,
+				func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(material.CheckBox(th, &isHqMode, "HQ Mode").Layout),
+						layout.Rigid(material.CheckBox(th, &showMeters, "Meters").Layout),
+						layout.Rigid(material.CheckBox(th, &loopCrossfadeToggle, "A-B Loop Crossfade").Layout),
+					)
+				},
+				func(gtx layout.Context) layout.Dimensions {
+					label := "Crossfade: Off (gapless)"
+					if crossfadeSlider.Value > 0 {
+						label = fmt.Sprintf("Crossfade: %.1fs", crossfadeSlider.Value*float32(player.MaxCrossfade.Seconds()))
+					}
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							gtx.Constraints.Min.X = gtx.Dp(180)
+							return material.Body1(th, label).Layout(gtx)
+						}),
+						layout.Flexed(1, material.Slider(th, &crossfadeSlider).Layout),
+					)
+				},
+				func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							gtx.Constraints.Min.X = gtx.Dp(180)
+							return material.Body1(th, fmt.Sprintf("Speed: %.2fx", sliderSpeed())).Layout(gtx)
+						}),
+						layout.Flexed(1, material.Slider(th, &speedSlider).Layout),
+						layout.Rigid(material.CheckBox(th, &preservePitchToggle, "Keep Pitch").Layout),
+					)
+				},
+				func(gtx layout.Context) layout.Dimensions {
+					semitones, cents := sliderPitch()
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							gtx.Constraints.Min.X = gtx.Dp(180)
+							return material.Body1(th, fmt.Sprintf("Pitch: %+d st", semitones)).Layout(gtx)
+						}),
+						layout.Flexed(1, material.Slider(th, &semitoneSlider).Layout),
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							gtx.Constraints.Min.X = gtx.Dp(80)
+							return material.Body1(th, fmt.Sprintf(" %+d ct", cents)).Layout(gtx)
+						}),
+						layout.Flexed(0.5, material.Slider(th, &centSlider).Layout),
+					)
+				},
+				func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(material.Body1(th, "Normalize:").Layout),
+						layout.Rigid(material.RadioButton(th, &normalizeEnum, normalizeOff, "Off").Layout),
+						layout.Rigid(material.RadioButton(th, &normalizeEnum, normalizeTrack, "Track").Layout),
+						layout.Rigid(material.RadioButton(th, &normalizeEnum, normalizeAlbum, "Album").Layout),
+						layout.Rigid(material.RadioButton(th, &normalizeEnum, normalizeLoudness, "LUFS").Layout),
+					)
+				},
+				func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(material.Body1(th, "Target:").Layout),
+						layout.Rigid(material.RadioButton(th, &normalizeTargetEnum, "-14", "-14").Layout),
+						layout.Rigid(material.RadioButton(th, &normalizeTargetEnum, "-18", "-18").Layout),
+						layout.Rigid(material.RadioButton(th, &normalizeTargetEnum, "-23", "-23 LUFS").Layout),
+						layout.Rigid(material.CheckBox(th, &preventClippingToggle, "No Clipping").Layout),
+						layout.Rigid(material.Body2(th, fmt.Sprintf(" %+.1f dB", currentUnit().appliedGain())).Layout),
+					)
+				},
+				material.Body2(th, loudnessLabel(currentUnit())).Layout,
+				func(gtx layout.Context) layout.Dimensions {
+					label := broadcastLabel(currentUnit())
+					if label == "" {
+						return layout.Dimensions{}
+					}
+					return material.Body2(th, label).Layout(gtx)
+				},
+				layout.Spacer{Height: itemSpacing}.Layout,
+				func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(material.Body1(th, "Visualizer:").Layout),
+						layout.Rigid(material.RadioButton(th, &visualizerMode, modeWaveform, "Waveform").Layout),
+						layout.Rigid(material.RadioButton(th, &visualizerMode, modeSpectrum, "Spectrum").Layout),
+						layout.Rigid(material.RadioButton(th, &visualizerMode, modeGoniometer, "Goniometer").Layout),
+					)
+				},
+				func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(material.RadioButton(th, &visualizerMode, modeSpectrogram, "Spectrogram").Layout),
+						layout.Rigid(material.RadioButton(th, &visualizerMode, modeTrackSpectrogram, "Track Spectrogram").Layout),
+					)
+				},
+				func(gtx layout.Context) layout.Dimensions {
+					if visualizerMode.Value != modeWaveform {
+						return layout.Dimensions{}
+					}
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(material.Body1(th, "Channels:").Layout),
+						layout.Rigid(material.RadioButton(th, &waveformLayout, waveformMono, "Mono").Layout),
+						layout.Rigid(material.RadioButton(th, &waveformLayout, waveformLanes, "L/R Lanes").Layout),
+						layout.Rigid(material.RadioButton(th, &waveformLayout, waveformMirror, "Mirrored").Layout),
+						layout.Rigid(material.RadioButton(th, &waveformLayout, waveformChannels, "All").Layout),
+					)
+				},
+				func(gtx layout.Context) layout.Dimensions {
+					if visualizerMode.Value != modeSpectrogram && visualizerMode.Value != modeTrackSpectrogram {
+						return layout.Dimensions{}
+					}
+					return layout.Flex{Axis: layout.Vertical, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+								layout.Rigid(material.Body1(th, "Colors:").Layout),
+								layout.Rigid(material.RadioButton(th, &spectrogramColormap, "magma", "Magma").Layout),
+								layout.Rigid(material.RadioButton(th, &spectrogramColormap, "viridis", "Viridis").Layout),
+								layout.Rigid(material.RadioButton(th, &spectrogramColormap, "gray", "Gray").Layout),
+								layout.Rigid(material.RadioButton(th, &spectrogramColormap, "waveform", "Waveform").Layout),
+							)
+						}),
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+								layout.Rigid(material.Body1(th, "Range:").Layout),
+								layout.Rigid(material.RadioButton(th, &spectrogramRange, "60", "60 dB").Layout),
+								layout.Rigid(material.RadioButton(th, &spectrogramRange, "90", "90 dB").Layout),
+								layout.Rigid(material.RadioButton(th, &spectrogramRange, "120", "120 dB").Layout),
+							)
+						}),
+					)
+				},
+				func(gtx layout.Context) layout.Dimensions {
+					if visualizerMode.Value != modeSpectrum {
+						return layout.Dimensions{}
+					}
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(material.Body1(th, "Smoothing:").Layout),
+						layout.Flexed(1, material.Slider(th, &spectrumSmoothing).Layout),
+					)
+				},
+				layout.Spacer{Height: itemSpacing}.Layout,
+				func(gtx layout.Context) layout.Dimensions {
+					children := []layout.FlexChild{layout.Rigid(material.Body1(th, "Export:").Layout)}
+					for _, size := range waveformExportSizes {
+						children = append(children, layout.Rigid(material.RadioButton(th, &waveformExportSize, size, size).Layout))
+					}
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx, children...)
+				},
+				func(gtx layout.Context) layout.Dimensions {
+					return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+						layout.Rigid(material.RadioButton(th, &waveformExportFormat, exportPNG, "PNG").Layout),
+						layout.Rigid(material.RadioButton(th, &waveformExportFormat, exportSVG, "SVG").Layout),
+						layout.Rigid(layout.Spacer{Width: itemSpacing}.Layout),
+						layout.Rigid(func(gtx layout.Context) layout.Dimensions {
+							if currentUnit() == nil {
+								return layout.Dimensions{}
+							}
+							return material.Button(th, &waveformExportButton, "Export Waveform").Layout(gtx)
+						}),
+					)
+				},
+			}
+			return material.List(th, &dialogList).Layout(gtx, len(rows), func(gtx C, i int) D {
+				gtx.Constraints.Min.X = 0 // centered by the list's alignment
+				return rows[i](gtx)
+			})
 		})
 	})
 }
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/gopxl/beep/v2"
+	"quickClip/player"
+)
+
+// EBU R128 / ITU-R BS.1770 loudness measurement
+const loudnessBlockDuration = 0.1 // seconds per measured block, momentary and short-term windows are made of blocks
+const momentaryBlocks = 4         // 400ms
+const shortTermBlocks = 30        // 3s
+const absoluteGate = -70.0        // LUFS
+const truePeakOversampling = 4
+const truePeakTaps = 12 // taps per phase of the oversampling filter
+
+const cacheKeySampleSize = 256 * 1024 // bytes hashed at the start and end of a source for its cache key
+
+// Loudness of a mean square K-weighted energy
+func energyToLUFS(energy float64) float64 {
+	if energy <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(energy)
+}
+
+func lufsToEnergy(lufs float64) float64 {
+	return math.Pow(10, (lufs+0.691)/10)
+}
+
+// Filters of the K-weighting (a high shelf for the head and a high pass) at sampleRate, as in libebur128
+func kWeighting(sampleRate float64) (shelf, highpass biquad) {
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / sampleRate)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / sampleRate)
+	a0 = 1 + k/q + k*k
+	highpass = biquad{b0: 1, b1: -2, b2: 1, a1: 2 * (k*k - 1) / a0, a2: (1 - k/q + k*k) / a0}
+	return shelf, highpass
+}
+
+// loudnessMeter K-weights stereo samples and sums their energy in 100ms blocks
+type loudnessMeter struct {
+	shelf, highpass biquad
+	state           [2][2][2]float64 // delay per filter and channel
+	blockLen        int
+	blockPos        int
+	blockSum        float64
+	recent          [shortTermBlocks]float64 // mean square of the latest blocks, a ring
+	recentPos       int
+	blocks          int // blocks measured so far
+}
+
+func newLoudnessMeter(sampleRate beep.SampleRate) *loudnessMeter {
+	m := &loudnessMeter{blockLen: max(int(float64(sampleRate)*loudnessBlockDuration), 1)}
+	m.shelf, m.highpass = kWeighting(float64(sampleRate))
+	return m
+}
+
+// Measure samples, onBlock is called after every completed block (may be nil)
+func (m *loudnessMeter) process(samples [][2]float64, onBlock func()) {
+	for _, sample := range samples {
+		for c := range 2 {
+			x := m.shelf.process(sample[c], &m.state[0][c])
+			x = m.highpass.process(x, &m.state[1][c])
+			m.blockSum += x * x
+		}
+		m.blockPos++
+		if m.blockPos == m.blockLen {
+			m.recent[m.recentPos] = m.blockSum / float64(m.blockLen)
+			m.recentPos = (m.recentPos + 1) % shortTermBlocks
+			m.blocks++
+			m.blockPos, m.blockSum = 0, 0
+			if onBlock != nil {
+				onBlock()
+			}
+		}
+	}
+}
+
+// Mean energy of the latest n blocks, 0 until n blocks were measured
+func (m *loudnessMeter) windowEnergy(n int) float64 {
+	if m.blocks < n {
+		return 0
+	}
+	var sum float64
+	for i := 1; i <= n; i++ {
+		sum += m.recent[(m.recentPos-i+shortTermBlocks)%shortTermBlocks]
+	}
+	return sum / float64(n)
+}
+
+// Momentary (400ms) and short-term (3s) loudness in LUFS
+func (m *loudnessMeter) momentary() float64 { return energyToLUFS(m.windowEnergy(momentaryBlocks)) }
+func (m *loudnessMeter) shortTerm() float64 { return energyToLUFS(m.windowEnergy(shortTermBlocks)) }
+
+func (m *loudnessMeter) reset() {
+	*m = loudnessMeter{shelf: m.shelf, highpass: m.highpass, blockLen: m.blockLen}
+}
+
+// truePeakMeter finds the peak of the signal oversampled 4x so peaks between samples aren't missed
+type truePeakMeter struct {
+	phases  [truePeakOversampling][truePeakTaps]float64
+	history [2][truePeakTaps]float64
+	pos     int
+	peak    float64
+}
+
+func newTruePeakMeter() *truePeakMeter {
+	t := &truePeakMeter{}
+	// Windowed sinc interpolation filter split into one sub filter per phase
+	const taps = truePeakOversampling * truePeakTaps
+	for i := range taps {
+		x := float64(i-taps/2) / truePeakOversampling
+		sinc := 1.0
+		if x != 0 {
+			sinc = math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/taps)
+		t.phases[i%truePeakOversampling][i/truePeakOversampling] = sinc * window
+	}
+	return t
+}
+
+func (t *truePeakMeter) process(samples [][2]float64) {
+	for _, sample := range samples {
+		t.pos = (t.pos + 1) % truePeakTaps
+		for c := range 2 {
+			t.history[c][t.pos] = sample[c]
+			t.peak = max(t.peak, math.Abs(sample[c]))
+			for _, phase := range t.phases {
+				var y float64
+				for k, coeff := range phase {
+					y += coeff * t.history[c][(t.pos-k+truePeakTaps)%truePeakTaps]
+				}
+				t.peak = max(t.peak, math.Abs(y))
+			}
+		}
+	}
+}
+
+// loudnessResult is the EBU R128 measurement of a whole track
+type loudnessResult struct {
+	Integrated float64 `json:"integrated"` // LUFS
+	Range      float64 `json:"range"`      // LU
+	TruePeak   float64 `json:"truePeak"`   // dBTP
+}
+
+// loudnessAnalyzer measures a whole track in the background, see trackAnalyzer
+type loudnessAnalyzer struct {
+	mu        sync.Mutex
+	meter     *loudnessMeter
+	truePeak  *truePeakMeter
+	momentary []float64 // energies of every 400ms window (overlapping by 75%)
+	shortTerm []float64 // energies of every 3s window
+	result    loudnessResult
+	done      bool
+	onDone    func(loudnessResult)
+	cacheKey  string
+}
+
+func newLoudnessAnalyzer(sampleRate beep.SampleRate, onDone func(loudnessResult)) *loudnessAnalyzer {
+	return &loudnessAnalyzer{
+		meter:    newLoudnessMeter(sampleRate),
+		truePeak: newTruePeakMeter(),
+		onDone:   onDone,
+	}
+}
+
+// Look up the measurement of the source with key in the cache, skipping the measurement if it was measured before
+// NOTE: call it before processing any samples so a new measurement is stored under key
+func (a *loudnessAnalyzer) useCache(key string) {
+	cached, ok := loudnessCache.lookup(key)
+	a.mu.Lock()
+	a.cacheKey = key
+	if !ok || a.done {
+		a.mu.Unlock()
+		return
+	}
+	a.result, a.done = cached, true
+	a.mu.Unlock()
+	if a.onDone != nil {
+		a.onDone(cached)
+	}
+}
+
+func (a *loudnessAnalyzer) process(samples [][2]float64) {
+	if _, done := a.measured(); done {
+		return // cached
+	}
+	a.truePeak.process(samples)
+	a.meter.process(samples, func() {
+		if e := a.meter.windowEnergy(momentaryBlocks); e > 0 {
+			a.momentary = append(a.momentary, e)
+		}
+		if e := a.meter.windowEnergy(shortTermBlocks); e > 0 {
+			a.shortTerm = append(a.shortTerm, e)
+		}
+	})
+}
+
+func (a *loudnessAnalyzer) finish() {
+	if _, done := a.measured(); done {
+		return
+	}
+	result := loudnessResult{
+		Integrated: integratedLoudness(a.momentary),
+		Range:      loudnessRange(a.shortTerm),
+		TruePeak:   20 * math.Log10(max(a.truePeak.peak, 1e-9)),
+	}
+	a.momentary, a.shortTerm = nil, nil
+
+	a.mu.Lock()
+	a.result, a.done = result, true
+	key := a.cacheKey
+	a.mu.Unlock()
+	loudnessCache.store(key, result)
+	if a.onDone != nil {
+		a.onDone(result)
+	}
+}
+
+// Return the measurement and whether the analysis has finished
+func (a *loudnessAnalyzer) measured() (loudnessResult, bool) {
+	if a == nil {
+		return loudnessResult{}, false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.result, a.done
+}
+
+// Gated integrated loudness of the 400ms window energies
+func integratedLoudness(energies []float64) float64 {
+	gated := gateEnergies(energies, absoluteGate)
+	if len(gated) == 0 {
+		return math.Inf(-1)
+	}
+	relativeGate := energyToLUFS(meanEnergy(gated)) - 10
+	return energyToLUFS(meanEnergy(gateEnergies(gated, relativeGate)))
+}
+
+// Loudness range (EBU Tech 3342) of the 3s window energies
+func loudnessRange(energies []float64) float64 {
+	gated := gateEnergies(energies, absoluteGate)
+	if len(gated) == 0 {
+		return 0
+	}
+	relativeGate := energyToLUFS(meanEnergy(gated)) - 20
+	gated = gateEnergies(gated, relativeGate)
+	if len(gated) == 0 {
+		return 0
+	}
+	levels := make([]float64, len(gated))
+	for i, e := range gated {
+		levels[i] = energyToLUFS(e)
+	}
+	slices.Sort(levels)
+	percentile := func(p float64) float64 {
+		return levels[int(math.Round(p*float64(len(levels)-1)))]
+	}
+	return percentile(0.95) - percentile(0.10)
+}
+
+// Return the energies louder than gate (in LUFS)
+func gateEnergies(energies []float64, gate float64) []float64 {
+	threshold := lufsToEnergy(gate)
+	var gated []float64
+	for _, e := range energies {
+		if e > threshold {
+			gated = append(gated, e)
+		}
+	}
+	return gated
+}
+
+func meanEnergy(energies []float64) float64 {
+	var sum float64
+	for _, e := range energies {
+		sum += e
+	}
+	return sum / float64(len(energies))
+}
+
+// Return a key to look up cached measurements of a source, hashing its size and the data at its start and end
+// NOTE: cheap for random access files, a forward-only source is read to the end for its size like by the decoders
+func sourceCacheKey(ctx context.Context, src player.Source) (string, error) {
+	r := src.NewReader()
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	binary.Write(h, binary.LittleEndian, size)
+	for _, offset := range []int64{0, max(size-cacheKeySampleSize, cacheKeySampleSize)} {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return "", err
+		}
+		if _, err := io.CopyN(h, r, cacheKeySampleSize); err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// loudnessResults caches measurements by sourceCacheKey, persisted in the user cache dir where there is one
+type loudnessResults struct {
+	mu      sync.Mutex
+	results map[string]loudnessResult
+	path    string // empty when the results can't be persisted (e.g. wasm)
+	loaded  bool
+}
+
+var loudnessCache = &loudnessResults{}
+
+// Load the persisted results once, caller must hold mu
+func (c *loudnessResults) loadLocked() {
+	if c.loaded {
+		return
+	}
+	c.loaded = true
+	c.results = make(map[string]loudnessResult)
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return
+	}
+	c.path = filepath.Join(dir, "quickClip", "loudness.json")
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return
+	}
+	if err := json.Unmarshal(data, &c.results); err != nil {
+		log.Println("Ignoring broken loudness cache:", err)
+	}
+}
+
+func (c *loudnessResults) lookup(key string) (loudnessResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loadLocked()
+	result, ok := c.results[key]
+	return result, ok
+}
+
+func (c *loudnessResults) store(key string, result loudnessResult) {
+	if key == "" || math.IsInf(result.Integrated, 0) { // JSON can't hold silent tracks, they are quick to measure again anyway
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loadLocked()
+	c.results[key] = result
+	if c.path == "" {
+		return
+	}
+	data, err := json.Marshal(c.results)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(c.path), 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(c.path, data, 0o644)
+	}
+	if err != nil {
+		log.Println("Couldn't save loudness cache:", err)
+	}
+}
@@ -3,10 +3,15 @@
 package main
 
 import (
+	"gioui.org/io/key"
 	"gioui.org/io/pointer"
 	"image/color"
+	"io"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"gioui.org/app"
 	"gioui.org/font/gofont"
@@ -14,14 +19,19 @@ import (
 	"gioui.org/text"
 	"gioui.org/unit"
 	"gioui.org/widget/material"
+	"quickClip/player"
 )
 
 // Channel to signal when the UI is ready
 var uiReadyChan = make(chan struct{})
 
 func main() {
+	if isCLIArgs(os.Args[1:]) { // headless subcommand, see cli.go
+		os.Exit(runCLI(os.Args[1:]))
+	}
+
+	w := new(app.Window)
 	go func() {
-		w := new(app.Window)
 		w.Option(app.Title("QuickClip"))
 		w.Option(app.Size(unit.Dp(800), unit.Dp(400)))
 
@@ -39,16 +49,40 @@ func main() {
 	// This is critical to allow the interface to show up before being blocked on WASM clients
 	<-uiReadyChan
 	initSpeaker()
+	go openFileArgs(w, os.Args[1:])
 	app.Main()
 }
 
+// Queue and play the files the app was started with (e.g. by "Open with"), ignoring flags like macOS' -psn_
+func openFileArgs(w *app.Window, args []string) {
+	var readers []io.ReadCloser
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			continue
+		}
+		file, err := os.Open(arg)
+		if err != nil {
+			log.Println("Couldn't open file:", err)
+			continue
+		}
+		readers = append(readers, file)
+	}
+	if len(readers) > 0 {
+		playEntry(w, queue.set(readers))
+	}
+}
+
 // Launch Gio rendering loop
 func loop(w *app.Window) error {
 	th := material.NewTheme()
 	th.Fg = color.NRGBA{R: 255, G: 255, B: 255, A: 255} // White foreground text
 	th.Bg = color.NRGBA{R: 30, G: 30, B: 30, A: 255}    // dark gray background
 	th.Shaper = text.NewShaper(text.WithCollection(gofont.Collection()))
-	volumeSlider.Value = float32(playbackVolume) // INITIAL VOLUME
+	volumeSlider.Value = float32(audio.Volume()) // INITIAL VOLUME
+
+	// Player events are handled on this goroutine so UI state needs no locking
+	events, _ := audio.Subscribe()
+	go watchPlayer(w)
 	var ops op.Ops
 	for {
 		e := w.Event()
@@ -57,11 +91,12 @@ func loop(w *app.Window) error {
 			return evt.Err
 		case app.FrameEvent:
 			gtx := app.NewContext(&ops, evt)
+			handlePlayerEvents(w, events)
 			if openButton.Clicked(gtx) {
 				go openFileDialog(w)
 			}
 			if playButton.Clicked(gtx) {
-				if currentState == NotInitialized || currentState == Finished {
+				if state := audio.State(); state == player.NotInitialized || state == player.Finished {
 					go openFileDialog(w)
 				} else {
 					play(w)
@@ -76,8 +111,78 @@ func loop(w *app.Window) error {
 			if backButton.Clicked(gtx) {
 				back()
 			}
+			if addButton.Clicked(gtx) {
+				go addFilesDialog(w)
+			}
+			if nextButton.Clicked(gtx) {
+				go playNext(w)
+			}
+			if prevButton.Clicked(gtx) {
+				go playPrevious(w)
+			}
+			if repeatButton.Clicked(gtx) {
+				queue.cycleRepeat()
+			}
+			if shuffleToggle.Update(gtx) {
+				queue.setShuffle(shuffleToggle.Value)
+			}
+			if i := clickedQueueEntry(gtx); i >= 0 {
+				go playEntry(w, queue.jump(i))
+			}
+			if exportClipButton.Clicked(gtx) {
+				go exportClipDialog(w)
+			}
+			if waveformExportButton.Clicked(gtx) {
+				go exportWaveformDialog(w)
+			}
+			if clearClipButton.Clicked(gtx) {
+				clearClipSelection()
+			}
+			if crossfadeSlider.Update(gtx) {
+				audio.SetCrossfade(time.Duration(float64(crossfadeSlider.Value) * float64(player.MaxCrossfade)))
+			}
+			if speedSlider.Update(gtx) || preservePitchToggle.Update(gtx) {
+				s := updateSettings(func(s *playbackSettings) {
+					s.speed, s.preservePitch = sliderSpeed(), preservePitchToggle.Value
+				})
+				currentUnit().setSpeed(s.speed, s.preservePitch)
+			}
+			if semitoneSlider.Update(gtx) || centSlider.Update(gtx) {
+				semitones, cents := sliderPitch()
+				s := updateSettings(func(s *playbackSettings) { s.pitch = float64(semitones) + float64(cents)/100 })
+				currentUnit().setPitch(s.pitch)
+			}
+			if loopAButton.Clicked(gtx) {
+				currentUnit().setLoopMarkerHere(markerA)
+			}
+			if loopBButton.Clicked(gtx) {
+				currentUnit().setLoopMarkerHere(markerB)
+			}
+			if clearLoopButton.Clicked(gtx) {
+				currentUnit().clearLoop()
+			}
+			if loopCrossfadeToggle.Update(gtx) {
+				updateSettings(func(s *playbackSettings) { s.loopCrossfade = loopCrossfadeToggle.Value })
+				currentUnit().setLoopCrossfade(loopCrossfadeToggle.Value)
+			}
+			if updateEqualizer(gtx) {
+				s := updateSettings(func(s *playbackSettings) { s.eqEnabled, s.eqBands = eqEnabled.Value, eqBands })
+				currentUnit().setEqualizer(s.equalizerBands())
+			}
+			if updateDownmix(gtx) {
+				currentUnit().applyDownmix()
+			}
+			if normalizeEnum.Update(gtx) || normalizeTargetEnum.Update(gtx) || preventClippingToggle.Update(gtx) {
+				s := updateSettings(func(s *playbackSettings) {
+					s.normalize.mode, s.normalize.preventClipping = normalizeEnum.Value, preventClippingToggle.Value
+					if target, err := strconv.ParseFloat(normalizeTargetEnum.Value, 64); err == nil {
+						s.normalize.target = target
+					}
+				})
+				currentUnit().applyNormalization(s.normalize)
+			}
 			if volumeSlider.Update(gtx) {
-				currentUnit.setVolume(volumeSlider.Value)
+				audio.SetVolume(float64(volumeSlider.Value))
 			}
 
 			if showDialog.Pressed() {
@@ -91,27 +196,57 @@ func loop(w *app.Window) error {
 				},
 			)
 			if progressBarEvt, ok := event.(pointer.Event); ok {
-				windowWidth := gtx.Constraints.Max.X - 10 // NOTE: we subtract left/right layout insets TODO: remove magic number
-				// Ratio of the progress bar to the window position (e.g. percentage through the bar from 0 to 1)
+				barWidth := max(progressBarWidth, 1) // measured while laying out the previous frame
+				// Ratio of the progress bar to the pointer position (e.g. percentage through the bar from 0 to 1)
 				// Note that the progressBarEvt position is relative to the WIDGET not the overall window
-				ratioPos := progressBarEvt.Position.X / float32(windowWidth)
+				ratioPos := progressBarEvt.Position.X / float32(barWidth)
 
 				switch progressBarEvt.Kind {
 				case pointer.Press:
+					if progressBarEvt.Modifiers.Contain(key.ModShift) { // Shift+Drag selects a clip region
+						isSelectingClip = true
+						clipStart, clipEnd = clipSampleAt(ratioPos), clipSampleAt(ratioPos)
+						break
+					}
+					if marker := loopMarkerAt(progressBarEvt.Position.X, barWidth, gtx.Dp(6)); marker != noMarker {
+						draggingLoopMarker, loopDragPos = marker, ratioPos // drag the A-B loop marker instead of seeking
+						break
+					}
 					isManualSeeking = true
 					manualSeekPosition = ratioPos
 				case pointer.Drag:
+					if isSelectingClip {
+						clipEnd = clipSampleAt(ratioPos)
+						break
+					}
+					if draggingLoopMarker != noMarker {
+						loopDragPos = ratioPos
+						break
+					}
 					manualSeekPosition = ratioPos
 				case pointer.Release: // TODO: doesn't always fire when leaving window, Leave evt fixes this but bad UX
+					if isSelectingClip {
+						clipEnd = clipSampleAt(ratioPos)
+						finishClipSelection()
+						break
+					}
+					if draggingLoopMarker != noMarker {
+						finishLoopMarkerDrag(ratioPos)
+						break
+					}
 					isManualSeeking = false
-					err := currentUnit.seekFloat(ratioPos)
+					err := audio.SeekRatio(ratioPos)
 					if err != nil {
-						log.Println("seekFloat error:", err)
+						log.Println("SeekRatio error:", err)
 					}
 					manualSeekPosition = ratioPos
 					playbackProgress = ratioPos
 				case pointer.Cancel: // user switched windows before release
 					isManualSeeking = false
+					if isSelectingClip {
+						finishClipSelection()
+					}
+					draggingLoopMarker = noMarker
 				default:
 					log.Println("Unknown pointer event", event)
 				}
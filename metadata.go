@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dhowden/tag"
+	"quickClip/player"
+)
+
+// Read the tags of r, including the AIFF chunks tag.ReadFrom doesn't know about
+func readMetadata(r io.ReadSeeker) (tag.Metadata, error) {
+	audioType, err := player.DetectType(r)
+	if err == nil && audioType == ".aiff" {
+		return readAIFFMetadata(r)
+	}
+	return tag.ReadFrom(r)
+}
+
+// Read an AIFF's ID3 chunk, falling back to its NAME, AUTH, (c) and ANNO text chunks
+func readAIFFMetadata(r io.ReadSeeker) (tag.Metadata, error) {
+	_, chunks, err := player.ReadChunks(r)
+	if err != nil {
+		return nil, err
+	}
+	text := &chunkMetadata{raw: map[string]interface{}{}}
+	for _, c := range chunks {
+		switch c.ID {
+		case "ID3 ", "id3 ":
+			data, err := player.ReadChunk(r, c)
+			if err != nil {
+				return nil, err
+			}
+			if m, err := tag.ReadFrom(bytes.NewReader(data)); err == nil {
+				return m, nil
+			}
+		case "NAME", "AUTH", "(c) ", "ANNO":
+			data, err := player.ReadChunk(r, c)
+			if err != nil {
+				return nil, err
+			}
+			text.add(c.ID, strings.TrimRight(string(data), "\x00 "))
+		}
+	}
+	if len(text.raw) == 0 {
+		return nil, fmt.Errorf("no AIFF tags found")
+	}
+	return text, nil
+}
+
+// chunkMetadata holds the text chunks of a file as tag.Metadata
+type chunkMetadata struct {
+	title, artist, comment string
+	raw                    map[string]interface{}
+}
+
+func (m *chunkMetadata) add(id, value string) {
+	switch id {
+	case "NAME":
+		m.title = value
+	case "AUTH":
+		m.artist = value
+	case "ANNO": // may appear more than once
+		m.comment = strings.TrimSpace(m.comment + "\n" + value)
+	}
+	m.raw[strings.TrimSpace(id)] = value
+}
+
+func (m *chunkMetadata) Format() tag.Format          { return tag.UnknownFormat }
+func (m *chunkMetadata) FileType() tag.FileType      { return tag.UnknownFileType }
+func (m *chunkMetadata) Title() string               { return m.title }
+func (m *chunkMetadata) Album() string               { return "" }
+func (m *chunkMetadata) Artist() string              { return m.artist }
+func (m *chunkMetadata) AlbumArtist() string         { return "" }
+func (m *chunkMetadata) Composer() string            { return "" }
+func (m *chunkMetadata) Year() int                   { return 0 }
+func (m *chunkMetadata) Genre() string               { return "" }
+func (m *chunkMetadata) Track() (int, int)           { return 0, 0 }
+func (m *chunkMetadata) Disc() (int, int)            { return 0, 0 }
+func (m *chunkMetadata) Picture() *tag.Picture       { return nil }
+func (m *chunkMetadata) Lyrics() string              { return "" }
+func (m *chunkMetadata) Comment() string             { return m.comment }
+func (m *chunkMetadata) Raw() map[string]interface{} { return m.raw }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sync"
+	"time"
+
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"github.com/gopxl/beep/v2"
+)
+
+const meterMinDb = -60.0
+const meterRMSWindow = 300 * time.Millisecond
+const clipHoldTime = 3 * time.Second
+
+var showMeters widget.Bool
+
+// levelMeter measures the samples going to the speaker, written from TapStreamer and read by the UI
+type levelMeter struct {
+	mu         sync.Mutex
+	peak       [2]float64 // highest absolute sample since the last reading
+	meanSquare [2]float64 // exponentially averaged over meterRMSWindow
+	rmsCoeff   float64
+	clippedAt  [2]time.Time
+	loudness   *loudnessMeter
+
+	// Peak-hold display state, only used by the UI
+	displayPeak [2]float64
+	peakTime    [2]time.Time
+	lastTime    time.Time
+}
+
+var levels = newLevelMeter(globalSampleRate)
+
+func newLevelMeter(sampleRate beep.SampleRate) *levelMeter {
+	return &levelMeter{
+		rmsCoeff: 1 - math.Exp(-1/(float64(sampleRate)*meterRMSWindow.Seconds())),
+		loudness: newLoudnessMeter(sampleRate),
+	}
+}
+
+// Measure samples before they're converted for the visualization
+func (m *levelMeter) process(samples [][2]float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var now time.Time
+	for _, sample := range samples {
+		for c := range 2 {
+			level := math.Abs(sample[c])
+			m.peak[c] = max(m.peak[c], level)
+			m.meanSquare[c] += m.rmsCoeff * (sample[c]*sample[c] - m.meanSquare[c])
+			if level >= 1 {
+				if now.IsZero() {
+					now = time.Now()
+				}
+				m.clippedAt[c] = now
+			}
+		}
+	}
+	m.loudness.process(samples, nil)
+}
+
+func (m *levelMeter) reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.peak, m.meanSquare, m.clippedAt = [2]float64{}, [2]float64{}, [2]time.Time{}
+	m.displayPeak = [2]float64{}
+	m.loudness.reset()
+}
+
+// levelReading is a snapshot of the meters, levels are in dBFS and LUFS
+type levelReading struct {
+	peak, holdPeak, rms  [2]float64
+	momentary, shortTerm float64
+	clipped              [2]bool
+}
+
+// Read the meters, the peak since the last reading is held for peakHoldTime before falling
+func (m *levelMeter) read() levelReading {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	elapsed := now.Sub(m.lastTime).Seconds()
+	if m.lastTime.IsZero() || elapsed > 1 {
+		elapsed = 0
+	}
+	m.lastTime = now
+
+	var r levelReading
+	for c := range 2 {
+		r.peak[c] = toDb(m.peak[c])
+		r.rms[c] = toDb(math.Sqrt(m.meanSquare[c]))
+		r.clipped[c] = now.Sub(m.clippedAt[c]) < clipHoldTime
+
+		if r.peak[c] >= m.displayPeak[c] {
+			m.displayPeak[c], m.peakTime[c] = r.peak[c], now
+		} else if now.Sub(m.peakTime[c]) > peakHoldTime {
+			m.displayPeak[c] = max(m.displayPeak[c]+meterMinDb*peakFallRate*elapsed, r.peak[c], meterMinDb)
+		}
+		r.holdPeak[c] = m.displayPeak[c]
+		m.peak[c] = 0
+	}
+	r.momentary, r.shortTerm = m.loudness.momentary(), m.loudness.shortTerm()
+	return r
+}
+
+// Level of a linear amplitude in dBFS, floored at meterMinDb
+func toDb(level float64) float64 {
+	if level <= 0 {
+		return meterMinDb
+	}
+	return max(20*math.Log10(level), meterMinDb)
+}
+
+// Draw peak and RMS bars of both channels with clip indicators and the loudness readings below
+func renderMeters(gtx layout.Context, th *material.Theme) layout.Dimensions {
+	r := levels.read()
+	width, height := gtx.Dp(unit.Dp(110)), gtx.Constraints.Max.Y
+	textHeight := gtx.Dp(unit.Dp(64))
+	clipHeight := gtx.Dp(unit.Dp(8))
+	barsTop, barsBottom := clipHeight+gtx.Dp(2), max(height-textHeight, clipHeight+gtx.Dp(20))
+	barWidth := gtx.Dp(unit.Dp(16))
+	levelY := func(db float64) int {
+		ratio := min(max((db-meterMinDb)/-meterMinDb, 0), 1)
+		return barsBottom - int(ratio*float64(barsBottom-barsTop))
+	}
+
+	// dB scale on the left of the bars
+	for _, db := range []float64{0, -6, -12, -24, -48} {
+		y := levelY(db)
+		paint.FillShape(gtx.Ops, color.NRGBA{R: 255, G: 255, B: 255, A: 30},
+			clip.Rect{Min: image.Pt(0, y), Max: image.Pt(width, y+1)}.Op())
+		offset := op.Offset(image.Pt(0, y-gtx.Dp(7))).Push(gtx.Ops)
+		label := material.Caption(th, fmt.Sprintf("%.0f", db))
+		label.Color = color.NRGBA{R: 255, G: 255, B: 255, A: 120}
+		labelGtx := gtx
+		labelGtx.Constraints.Min = image.Point{}
+		label.Layout(labelGtx)
+		offset.Pop()
+	}
+
+	for c, barColor := range []color.NRGBA{waveformColor1, waveformColor2} {
+		left := gtx.Dp(unit.Dp(30)) + c*(barWidth+gtx.Dp(4))
+		right := left + barWidth
+		paint.FillShape(gtx.Ops, color.NRGBA{R: 50, G: 50, B: 50, A: 255},
+			clip.Rect{Min: image.Pt(left, barsTop), Max: image.Pt(right, barsBottom)}.Op())
+
+		rmsColor := barColor
+		rmsColor.A = 255
+		peakColor := rmsColor
+		peakColor.A = 110
+		paint.FillShape(gtx.Ops, peakColor, clip.Rect{Min: image.Pt(left, levelY(r.peak[c])), Max: image.Pt(right, barsBottom)}.Op())
+		paint.FillShape(gtx.Ops, rmsColor, clip.Rect{Min: image.Pt(left, levelY(r.rms[c])), Max: image.Pt(right, barsBottom)}.Op())
+		holdY := levelY(r.holdPeak[c])
+		paint.FillShape(gtx.Ops, color.NRGBA{R: 255, G: 255, B: 255, A: 220},
+			clip.Rect{Min: image.Pt(left, holdY-1), Max: image.Pt(right, holdY+1)}.Op())
+
+		clipColor := color.NRGBA{R: 70, G: 20, B: 20, A: 255}
+		if r.clipped[c] {
+			clipColor = color.NRGBA{R: 255, G: 30, B: 30, A: 255}
+		}
+		paint.FillShape(gtx.Ops, clipColor, clip.Rect{Min: image.Pt(left, 0), Max: image.Pt(right, clipHeight)}.Op())
+	}
+
+	// Readings below the bars
+	lines := []string{
+		fmt.Sprintf("Pk  %5.1f %5.1f", r.peak[0], r.peak[1]),
+		fmt.Sprintf("RMS %5.1f %5.1f", r.rms[0], r.rms[1]),
+		fmt.Sprintf("M %6.1f LUFS", max(r.momentary, meterMinDb)),
+		fmt.Sprintf("S %6.1f LUFS", max(r.shortTerm, meterMinDb)),
+	}
+	for i, line := range lines {
+		offset := op.Offset(image.Pt(0, barsBottom+gtx.Dp(2)+i*gtx.Dp(15))).Push(gtx.Ops)
+		label := material.Caption(th, line)
+		label.Color = color.NRGBA{R: 220, G: 220, B: 220, A: 255}
+		labelGtx := gtx
+		labelGtx.Constraints.Min = image.Point{}
+		label.Layout(labelGtx)
+		offset.Pop()
+	}
+	return layout.Dimensions{Size: image.Pt(width, height)}
+}
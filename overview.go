@@ -0,0 +1,11 @@
+package main
+
+import "quickClip/player"
+
+// overviewAnalyzer fills the unit's player.Overview from the background analysis, see trackAnalyzer
+type overviewAnalyzer struct {
+	*player.Overview
+}
+
+func (a overviewAnalyzer) process(samples [][2]float64) { a.Process(samples) }
+func (a overviewAnalyzer) finish()                      { a.Finish() }
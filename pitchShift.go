@@ -0,0 +1,65 @@
+package main
+
+import (
+	"math"
+
+	"github.com/gopxl/beep/v2"
+)
+
+const maxPitchSemitones = 12 // the pitch can be shifted up or down by an octave
+
+// pitchShifter shifts the pitch by a number of semitones without changing the speed,
+// it stretches the audio by the pitch ratio and resamples it back to the original length
+type pitchShifter struct {
+	s          beep.Streamer
+	semitones  float64
+	stretcher  *timeStretcher
+	resampler  *beep.Resampler
+	sampleRate beep.SampleRate
+}
+
+// Create a pitchShifter for s playing at sampleRate, it starts without shifting
+func newPitchShifter(s beep.Streamer, sampleRate beep.SampleRate) *pitchShifter {
+	p := &pitchShifter{s: s, sampleRate: sampleRate}
+	p.reset()
+	return p
+}
+
+// Return the frequency ratio of the shift (e.g. 2 for an octave up)
+func (p *pitchShifter) ratio() float64 {
+	return math.Pow(2, p.semitones/12)
+}
+
+// Drop any buffered audio, e.g. after seeking
+func (p *pitchShifter) reset() {
+	p.stretcher = newTimeStretcher(p.s, p.sampleRate)
+	p.stretcher.setSpeed(1 / p.ratio())
+	p.resampler = beep.ResampleRatio(4, p.ratio(), p.stretcher)
+}
+
+// Shift the pitch by semitones (fractions for cents), 0 passes the input through untouched
+func (p *pitchShifter) setSemitones(semitones float64) {
+	semitones = min(max(semitones, -maxPitchSemitones), maxPitchSemitones)
+	if semitones == p.semitones {
+		return
+	}
+	wasShifting := p.semitones != 0
+	p.semitones = semitones
+	if !wasShifting { // buffers hold audio from before the shifter was bypassed
+		p.reset()
+		return
+	}
+	p.stretcher.setSpeed(1 / p.ratio())
+	p.resampler.SetRatio(p.ratio())
+}
+
+func (p *pitchShifter) Stream(samples [][2]float64) (n int, ok bool) {
+	if p.semitones == 0 {
+		return p.s.Stream(samples)
+	}
+	return p.resampler.Stream(samples)
+}
+
+func (p *pitchShifter) Err() error {
+	return p.s.Err()
+}
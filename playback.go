@@ -1,332 +1,206 @@
 package main
 
 import (
-	"bytes"
-	"errors"
+	"context"
 	"fmt"
 	"io"
 	"log"
-	"time"
+	"math"
 
 	"gioui.org/app"
 	"github.com/dhowden/tag"
 	"github.com/gopxl/beep/v2"
 	"github.com/gopxl/beep/v2/effects"
-	"github.com/gopxl/beep/v2/flac"
-	"github.com/gopxl/beep/v2/mp3"
 	"github.com/gopxl/beep/v2/speaker"
-	"github.com/gopxl/beep/v2/wav"
+	"quickClip/player"
+	"quickClip/player/speakerout"
 )
 
-var currentReader io.ReadCloser
-var currentUnit *playbackUnit
-
-var globalSampleRate beep.SampleRate = 44100
-
-const bufferSize = 44100 * 2 * 2 // 1 second of STEREO audio at 44.1kHz
-var audioRingBuffer = make([]byte, bufferSize)
-var ringWritePos = 0
-var playbackVolume = 0.7 // initial playbackVolume 70%
-
-// PlaybackState contains the various possible states of our playback
-type PlaybackState int
-
-const (
-	NotInitialized PlaybackState = iota
-	Playing
-	Suspended
-	Finished
-)
-
-var currentState PlaybackState = NotInitialized
+const globalSampleRate = player.SampleRate
 
 // Initialize the global speaker, this should only need to run once
 func initSpeaker() {
-	// NOTE: fixed buffer size for wasm MUST be divisible by 2
-	err := speaker.Init(globalSampleRate, 8194)
-	if err != nil {
+	if err := speakerout.Init(); err != nil {
 		log.Fatalln("Speaker INIT failed!:", err)
-		return
 	}
 }
 
-// Read the MagicBytes of the file to determine the fileType and return the file extension (e.g. ".wav" for wave files)
-func detectMagicBytes(r io.ReadSeeker) (string, error) {
-	const headerSize = 12
-	header := make([]byte, headerSize)
-
-	// Read the first 12 bytes.
-	n, err := io.ReadFull(r, header)
-	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
-		return "", fmt.Errorf("error reading magic bytes: %w", err)
-	}
-	header = header[:n]
-
-	// Determine file type from header.
-	fileType := determineFileType(header)
-
-	// Reset reader position.
-	_, err = r.Seek(0, io.SeekStart)
-	if err != nil {
-		return "", fmt.Errorf("failed to reset reader position: %w", err)
-	}
-
-	return fileType, nil
+type playbackUnit struct {
+	format     beep.Format
+	streamer   beep.StreamSeeker
+	loop       *abLoop // repeats the A-B loop region once set
+	resampler  *beep.Resampler
+	stretcher  *timeStretcher // changes speed without changing pitch
+	pitch      *pitchShifter
+	eq         *parametricEQ
+	gain       *effects.Gain // loudness normalization, see applyNormalization
+	AudioType  string        // e.g. ".wav", ".flac", ".mp3", ".ogg", ".opus", ".aiff" or ".m4a"
+	Metadata   tag.Metadata
+	Broadcast  *broadcastMetadata // BWF bext/iXML of WAV files, nil if there are none
+	replayGain replayGain
+
+	source player.Source // hands out independent readers of the file (e.g. for analysis and clip export)
+
+	ctx         context.Context // cancelled once the unit is closed to stop background analysis
+	cancel      context.CancelFunc
+	overview    *player.Overview  // whole track peak summary, filled in the background
+	spectrogram *trackSpectrogram // whole track spectrogram, filled in the background
+	loudness    *loudnessAnalyzer // EBU R128 measurement, done in the background
+
+	loopCrossfade bool // blend the end of the A-B loop into its start, guarded by the speaker lock
 }
 
-// Helper method to get the relevant file extension based on the magic bytes of the input bytes
-func determineFileType(header []byte) string {
-	switch {
-	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "WAVE":
-		return ".wav"
-	case len(header) >= 3 && string(header[:3]) == "ID3":
-		return ".mp3"
-	case len(header) >= 2 && header[0] == 0xFF && (header[1]&0xF6) == 0xF2:
-		return ".mp3"
-	case len(header) >= 4 && string(header[:4]) == "fLaC":
-		return ".flac"
-	default:
-		log.Println("Could not determine audio type by magic bytes")
-		return ""
+// Stop any background work of the unit, it shouldn't be used for playback afterward
+func (p *playbackUnit) Close() {
+	if p == nil {
+		return
 	}
+	p.cancel()
 }
 
-type seekableReadCloser struct {
-	io.ReadSeeker
-}
-
-func (s *seekableReadCloser) Close() error {
-	return nil // no-op; nothing to close for in-memory data
-}
-
-// Read all the content into memory and wrap in a seekable io.ReadSeeker
-func makeSeekable(r io.ReadCloser) (io.ReadSeeker, error) {
-	buf, err := io.ReadAll(r)
-	if err != nil {
-		return nil, fmt.Errorf("failed to buffer reader: %w", err)
+// Open a fresh decoder over the unit's source which doesn't disturb the playing streamer
+func (p *playbackUnit) openDecoder() (beep.StreamSeekCloser, beep.Format, error) {
+	if p == nil || p.source == nil {
+		return nil, beep.Format{}, fmt.Errorf("openDecoder: source not available")
 	}
-	return bytes.NewReader(buf), nil
-}
-
-type playbackUnit struct {
-	format    beep.Format
-	streamer  beep.StreamSeeker
-	ctrl      *beep.Ctrl
-	resampler *beep.Resampler
-	volume    *effects.Volume
-	done      chan bool
-	AudioType string // e.g. ".wav", ".flac", or ".mp3"
-	Metadata  tag.Metadata
+	streamer, format, _, err := player.Decode(p.source.NewReader())
+	if d, ok := streamer.(*player.Downmix); ok && p.downmix() != nil { // mix it like the playing streamer
+		d.SetMatrix(p.downmix().Matrix())
+	}
+	return streamer, format, err
 }
 
-// Move the playback position by provided d Duration
-// NOTE: will clamp within the bounds of the stream
-func (p *playbackUnit) seek(d time.Duration) (err error) {
-	if p == nil {
-		return fmt.Errorf("seek: playbackUnit was nil")
-	}
-	speaker.Lock()
-	newPos := p.streamer.Position()
-	newPos += p.format.SampleRate.N(d)
+// The unit is the player.Track of its file, the player calls these with the speaker locked
 
-	// Clamp the position to be within the stream
-	newPos = max(newPos, 0)
-	newPos = min(newPos, p.streamer.Len()-1)
+func (p *playbackUnit) Stream(samples [][2]float64) (int, bool) { return p.gain.Stream(samples) }
+func (p *playbackUnit) Err() error                              { return p.gain.Err() }
+func (p *playbackUnit) Format() beep.Format                     { return p.format }
+func (p *playbackUnit) Len() int                                { return p.streamer.Len() }
+func (p *playbackUnit) Position() int                           { return p.streamer.Position() }
 
-	err = p.streamer.Seek(newPos)
-	speaker.Unlock()
+// Seek to pos and drop the audio buffered by the effects
+func (p *playbackUnit) Seek(pos int) error {
+	err := p.streamer.Seek(pos)
+	p.stretcher.reset()
+	p.pitch.reset()
 	return err
 }
 
-// Seek to float position from 0.0 to 1.0 (e.g. from progress bar position)
-func (p *playbackUnit) seekFloat(ratio float32) (err error) {
+// Set the playback speed from 0.5 to 2.0, either time-stretched (keeping the pitch) or resampled like a tape
+func (p *playbackUnit) setSpeed(speed float64, keepPitch bool) {
 	if p == nil {
-		return fmt.Errorf("seekFloat: playbackUnit was nil")
+		return
 	}
+	speed = min(max(speed, minPlaybackSpeed), maxPlaybackSpeed)
+	ratio := float64(p.format.SampleRate) / float64(globalSampleRate)
 
-	totalSamples := p.streamer.Len() - 1
-	if totalSamples <= 0 {
-		return nil
-	}
-	ratio = min(max(ratio, 0.0), 1.0) // Clamp to valid range
 	speaker.Lock()
-
-	newPos := int(ratio * float32(totalSamples))
-	newPos = max(newPos, 0)
-	newPos = min(newPos, p.streamer.Len()-1)
-	err = p.streamer.Seek(newPos)
-	speaker.Unlock()
-
-	return err
+	defer speaker.Unlock()
+	if keepPitch {
+		p.resampler.SetRatio(ratio)
+		p.stretcher.setSpeed(speed)
+	} else {
+		p.resampler.SetRatio(ratio * speed)
+		p.stretcher.setSpeed(1)
+	}
 }
 
-func (p *playbackUnit) setPaused(state bool) {
+// Shift the pitch by semitones (e.g. 0.5 for 50 cents up) without changing the speed
+func (p *playbackUnit) setPitch(semitones float64) {
 	if p == nil {
 		return
 	}
-
 	speaker.Lock()
-	log.Println("Setting paused to:", state)
-	p.ctrl.Paused = state
+	p.pitch.setSemitones(semitones)
 	speaker.Unlock()
-
 }
 
-// Set volume level of the playbackUnit from 0.0 (0%) to 1.0 (100%)
-func (p *playbackUnit) setVolume(level float32) {
-	if p == nil {
-		return
-	}
-	playbackVolume = float64(level)
-	if level == 0.0 {
-		p.volume.Silent = true
-		return
-	}
-
-	percentage := level * 100
-	if percentage < 0 {
-		percentage = 0
-	} else if percentage > 100 {
-		percentage = 100
-	}
-
-	dB := 60 * (percentage/100 - 1)
-	p.volume.Base = 2
-	p.volume.Volume = float64(dB / 10)
-	p.volume.Silent = false
+// Return the effective playback speed, caller must hold the speaker lock
+func (p *playbackUnit) speed() float64 {
+	return p.resampler.Ratio() * float64(globalSampleRate) / float64(p.format.SampleRate) * p.stretcher.speed
 }
 
-// return the percentage of playback progress as a float32 (e.g. for progressbar updates)
-func (p *playbackUnit) getProgressFloat() float32 {
-	if p == nil {
-		return 0.0
+// Return the number of samples at the speaker's sample rate left until the end of the track
+func (p *playbackUnit) Remaining() int {
+	if p.loop.active() && p.streamer.Position() < p.loop.end {
+		return math.MaxInt // never reaches the end while looping
 	}
-	totalSamples := p.streamer.Len()
-	if totalSamples > 0 {
-		return float32(p.streamer.Position()) / float32(totalSamples)
-	}
-	return 0.0
+	left := p.streamer.Len() - p.streamer.Position()
+	return int(float64(left) * float64(globalSampleRate) / float64(p.format.SampleRate) / p.speed())
 }
 
-// Create a new PlaybackUnit with the various decoders/streamers
-func newPlaybackUnit(reader io.ReadCloser) (*playbackUnit, error) {
+// Open the reader and pick its decoder without setting up playback (e.g. for the command line)
+func openPlaybackUnit(reader io.ReadCloser) (*playbackUnit, error) {
 	var err error
-	unit := &playbackUnit{done: make(chan bool)}
+	unit := &playbackUnit{}
+	unit.ctx, unit.cancel = context.WithCancel(context.Background())
 
-	// Convert the currentReader to a seekable stream (read whole file into memory)
-	seekableReader, err := makeSeekable(reader)
+	// Wrap the currentReader so it can be seeked and read independently, without reading the whole file first
+	unit.source, err = player.MakeSeekable(reader)
 	if err != nil {
 		log.Println("Failed to make reader seekable:", err)
 		return nil, err
 	}
+	seekableReader := unit.source.NewReader()
 
-	unit.Metadata, err = tag.ReadFrom(seekableReader)
+	unit.Metadata, err = readMetadata(seekableReader)
 	if err != nil {
 		log.Println("Error Reading Metadata:", err)
 	} else {
 		log.Println("Read Metadata:", unit.Metadata.Title())
 	}
+	unit.replayGain = parseReplayGain(unit.Metadata)
+	unit.Broadcast, err = readBroadcastMetadata(seekableReader)
+	if err != nil {
+		log.Println("Error Reading Broadcast Metadata:", err)
+	}
 
 	_, err = seekableReader.Seek(0, io.SeekStart)
 	if err != nil {
 		log.Println("Couldn't reset seekableReader after reading tags!")
 	} // reset seek position
 
-	// Wrap seekableReader in a closer to satisfy mp3 decoder
-	rc := &seekableReadCloser{seekableReader}
-
-	audioType, err := detectMagicBytes(seekableReader)
+	unit.streamer, unit.format, unit.AudioType, err = player.Decode(seekableReader)
 	if err != nil {
 		return nil, err
 	}
-	switch audioType {
-	case ".mp3":
-		log.Println("Using mp3 decoder")
-		unit.streamer, unit.format, err = mp3.Decode(rc)
-	case ".wav":
-		log.Println("Using wav decoder")
-		unit.streamer, unit.format, err = wav.Decode(rc)
-	case ".flac":
-		log.Println("Using flac decoder")
-		unit.streamer, unit.format, err = flac.Decode(rc)
-	default:
-		return nil, fmt.Errorf("no decoder available for %v", audioType)
-	}
 	log.Println("Audio format", unit.format)
+	return unit, nil
+}
 
+// Create a new PlaybackUnit with the various decoders/streamers, set up with s
+func newPlaybackUnit(reader io.ReadCloser, s playbackSettings) (*playbackUnit, error) {
+	unit, err := openPlaybackUnit(reader)
 	if err != nil {
-		return nil, fmt.Errorf("decoder failed for %v: %v", audioType, err)
-	}
-
-	loopStreamer, err := beep.Loop2(unit.streamer, beep.LoopTimes(0))
-	if err != nil {
-		log.Println("loop2 err:", err)
 		return nil, err
 	}
-
-	unit.ctrl = &beep.Ctrl{Streamer: loopStreamer}
-	// Resample to the Speaker's sample rate
-	resampler := beep.Resample(4, unit.format.SampleRate, globalSampleRate, unit.ctrl)
-	tap := &TapStreamer{s: resampler}
-	unit.volume = &effects.Volume{Streamer: tap}
-	unit.setVolume(float32(playbackVolume)) // set default volume
+	unit.setupPlayback(s)
+	unit.startAnalysis()
 	return unit, nil
 }
 
-// playAudio plays the current (last) reader provided by the file explorer
-func playAudio(w *app.Window) {
-	if currentReader == nil {
-		log.Println("playAudio: No audio reader")
-		return
-	} else if currentState == Playing {
-		return
-	}
-
-	if currentUnit != nil {
-		speaker.Clear()
-	}
-	playbackUnit, err := newPlaybackUnit(currentReader)
-	if err != nil {
-		log.Println("Couldn't create playback unit:", err)
-	}
-
-	log.Println("Play NOW")
-	currentUnit = playbackUnit
-	if playbackUnit == nil || playbackUnit.volume == nil {
-		log.Println("Playback unit streamer not available")
-		w.Option(app.Title("QuickClip -> Playback Unavailable"))
-		return
-	}
-	currentState = Playing
+// Put the effects between the decoder and the speaker so the unit can be played as a player.Track
+func (p *playbackUnit) setupPlayback(s playbackSettings) {
+	p.loop = newABLoop(p.streamer)
+	// Resample to the Speaker's sample rate
+	p.resampler = beep.Resample(4, p.format.SampleRate, globalSampleRate, p.loop)
+	p.stretcher = newTimeStretcher(p.resampler, globalSampleRate)
+	p.pitch = newPitchShifter(p.stretcher, globalSampleRate)
+	p.eq = newParametricEQ(p.pitch, globalSampleRate)
+	p.eq.setBands(s.equalizerBands())
+	p.gain = &effects.Gain{Streamer: p.eq}
+	p.loopCrossfade = s.loopCrossfade
+	p.setSpeed(s.speed, s.preservePitch)
+	p.setPitch(s.pitch)
+	p.applyNormalization(s.normalize)
+	p.applyDownmix()
+}
 
-	if currentUnit.Metadata != nil { // NOTE: nil if no tags exist in file
-		w.Option(app.Title("QuickClip -> " + currentUnit.Metadata.Artist() + " - " + currentUnit.Metadata.Title()))
+// Show the unit's metadata in the window title
+func updateTitle(w *app.Window, unit *playbackUnit) {
+	if unit != nil && unit.Metadata != nil { // NOTE: nil if no tags exist in file
+		w.Option(app.Title("QuickClip -> " + unit.Metadata.Artist() + " - " + unit.Metadata.Title()))
 	} else {
 		w.Option(app.Title("QuickClip"))
 	}
-
-	speaker.Play(beep.Seq(playbackUnit.volume, beep.Callback(func() {
-		playbackUnit.done <- true
-	})))
-
-	ticker := time.NewTicker(time.Millisecond * 16) // ~60 FPS
-	defer ticker.Stop()
-
-	// Wait for Ticker or playback done channel
-	for {
-		select {
-		case <-ticker.C: // Force redraw at ticker interval
-			updateProgressBar(playbackUnit)
-			w.Invalidate()
-
-		case <-playbackUnit.done:
-			log.Println("Audio DONE")
-			resetVisualization()
-			resetProgressBar()
-			currentState = Finished
-			w.Option(app.Title("QuickClip -> Not Playing"))
-			w.Invalidate()
-			return
-		}
-	}
 }
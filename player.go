@@ -1,52 +1,191 @@
 package main
 
 import (
+	"io"
 	"log"
 	"time"
 
 	"gioui.org/app"
+	"quickClip/player"
+	"quickClip/player/speakerout"
 )
 
+const prepareAhead = 5 * time.Second // decode the next queued track this long before it's needed
+
+var audio = player.New(speakerout.Speaker)
+
+// Queue entry of the track prepared with SetNext, only accessed from the frame loop
+var preparedEntry *queueEntry
+var preparing bool
+var unpreparable *queueEntry // failed to prepare, played after a gap instead of retrying it
+
+// preparation is handed back to the frame loop when a prepared track wasn't continued with
+type preparation struct {
+	entry *queueEntry
+	err   error // nil if the player had moved on in the meantime
+}
+
+var abandonedPreparations = make(chan preparation, 4)
+
+func init() {
+	audio.Open = func(r io.ReadCloser) (player.Track, error) {
+		unit, err := newPlaybackUnit(r, currentSettings())
+		if err != nil {
+			return nil, err
+		}
+		return unit, nil
+	}
+	audio.Observe = levels.process // meter the full float precision
+}
+
+// Return the playing unit, nil if nothing is loaded
+func currentUnit() *playbackUnit {
+	unit, _ := audio.Track().(*playbackUnit)
+	return unit
+}
+
 func play(w *app.Window) {
-	if currentState == Suspended { // Resume Paused playback
-		currentUnit.setPaused(false)
-		currentState = Playing
-		return
+	if err := audio.Play(); err != nil {
+		log.Println("play:", err)
 	}
-	go playAudio(w)
 }
 
 func stop() {
-	if currentState != NotInitialized && currentState != Finished {
-		currentUnit.setPaused(true)
-		currentState = Suspended
+	if audio.State() == player.Playing {
+		audio.Pause()
 	}
 }
 
+// Stop playback and close the loaded track, the frame loop resets the UI once it sees the state change
 func eject() {
-	if currentState == Playing || currentState == Suspended { // Stop ongoing playback
-		log.Println("Currently playing or suspended, EJECTING")
-		stop()
-		currentUnit.done <- true
+	audio.Eject()
+	log.Println("Ejected current file and reset state.")
+}
+
+// Load reader into the player and start playing it
+func loadAndPlay(w *app.Window, reader io.ReadCloser) {
+	if err := audio.Load(reader); err != nil { // reported to handlePlayerEvents as well
+		log.Println("Couldn't create playback unit:", err)
+		return
 	}
+	log.Println("Play NOW")
+	play(w)
+}
 
-	// Reset any other relevant state
-	currentState = NotInitialized
-	resetVisualization() // Reset any ongoing visualization updates
+// Redraw on every player event and continuously while playing, the frame loop handles the events themselves
+func watchPlayer(w *app.Window) {
+	events, _ := audio.Subscribe()
+	ticker := time.NewTicker(time.Millisecond * 16) // ~60 FPS
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C: // Force redraw at ticker interval
+			if audio.State() == player.Playing {
+				w.Invalidate()
+			}
+		case <-events:
+			w.Invalidate()
+		}
+	}
+}
 
-	log.Println("Ejected current file and reset state.")
+// Apply the player's events received since the last frame to the queue, window title and visualizations
+// NOTE: must only be called from the frame loop, which owns that state
+func handlePlayerEvents(w *app.Window, events <-chan player.Event) {
+	for {
+		var event player.Event
+		select {
+		case event = <-events:
+		case p := <-abandonedPreparations:
+			if p.entry == preparedEntry {
+				preparing, preparedEntry = false, nil
+			}
+			if p.err != nil {
+				unpreparable = p.entry
+			}
+			continue
+		default:
+			return
+		}
+
+		switch e := event.(type) {
+		case player.PositionChanged:
+			if e.Duration > 0 {
+				playbackProgress = float32(e.Position) / float32(e.Duration)
+			}
+			prepareNext()
+		case player.TrackLoaded:
+			unit, _ := e.Track.(*playbackUnit)
+			if e.Gapless { // continued with the prepared track without stopping
+				log.Println("Continuing with next track")
+				queue.jumpToEntry(preparedEntry)
+				preparing = false
+			}
+			unpreparable = nil
+			queue.updateCurrent(unit)
+			updateTitle(w, unit)
+		case player.Error:
+			log.Println("Playback error:", e.Err)
+			w.Option(app.Title("QuickClip -> Playback Unavailable"))
+		case player.StateChanged:
+			switch e.To {
+			case player.NotInitialized: // ejected
+				resetVisualization()
+				resetProgressBar()
+				clearClipSelection()
+				preparing = false
+			case player.Finished:
+				log.Println("Audio DONE")
+				resetVisualization()
+				resetProgressBar()
+				preparing = false
+				if next := queue.next(false); next != nil { // continue with the queue
+					go loadAndPlay(w, next.open())
+					break
+				}
+				w.Option(app.Title("QuickClip -> Not Playing"))
+			}
+		}
+	}
+}
+
+// Decode the next queued track in the background once the current one is about to end
+// NOTE: must only be called from the frame loop
+func prepareNext() {
+	if preparing || audio.Remaining() > prepareAhead+audio.Crossfade() {
+		return
+	}
+	current := audio.Track()
+	entry := queue.peekNext()
+	if current == nil || entry == nil || entry == unpreparable {
+		return
+	}
+	preparing, preparedEntry = true, entry
+	s := currentSettings()
+	go func() {
+		unit, err := newPlaybackUnit(entry.open(), s)
+		if err != nil {
+			log.Println("Couldn't prepare next track:", err)
+			abandonedPreparations <- preparation{entry: entry, err: err}
+			return
+		}
+		if !audio.SetNext(current, unit) { // ejected or skipped in the meantime
+			unit.Close()
+			abandonedPreparations <- preparation{entry: entry}
+		}
+	}()
 }
 
 func forward() {
-	if err := currentUnit.seek(5 * time.Second); err != nil {
+	if err := audio.Seek(audio.Position() + 5*time.Second); err != nil {
 		return
 	}
-	updateProgressBar(currentUnit)
+	updateProgressBar()
 }
 
 func back() {
-	if err := currentUnit.seek(-2500 * time.Millisecond); err != nil {
+	if err := audio.Seek(audio.Position() - 2500*time.Millisecond); err != nil {
 		return
 	}
-	updateProgressBar(currentUnit)
+	updateProgressBar()
 }
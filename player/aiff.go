@@ -0,0 +1,100 @@
+package player
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// Decode an AIFF, or an uncompressed AIFC, file with 8 to 32-bit PCM samples
+func decodeAIFF(r io.ReadSeeker) (beep.StreamSeekCloser, beep.Format, error) {
+	form, chunks, err := ReadChunks(r)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("aiff: %w", err)
+	}
+	if form != "AIFF" && form != "AIFC" {
+		return nil, beep.Format{}, fmt.Errorf("aiff: not an AIFF file")
+	}
+	var comm, ssnd *Chunk
+	for i := range chunks {
+		switch chunks[i].ID {
+		case "COMM":
+			comm = &chunks[i]
+		case "SSND":
+			ssnd = &chunks[i]
+		}
+	}
+	if comm == nil || ssnd == nil {
+		return nil, beep.Format{}, fmt.Errorf("aiff: missing COMM or SSND chunk")
+	}
+
+	data, err := ReadChunk(r, *comm)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	if len(data) < 18 || (form == "AIFC" && len(data) < 22) {
+		return nil, beep.Format{}, fmt.Errorf("aiff: COMM chunk too short")
+	}
+	channels := int(binary.BigEndian.Uint16(data[0:]))
+	frames := int(binary.BigEndian.Uint32(data[2:]))
+	bits := int(binary.BigEndian.Uint16(data[6:]))
+	sampleRate := extendedToFloat(data[8:18])
+	bigEndian := true
+	if form == "AIFC" {
+		switch compression := string(data[18:22]); compression {
+		case "NONE", "twos":
+		case "sowt": // little-endian, e.g. from macOS recording tools
+			bigEndian = false
+		default:
+			return nil, beep.Format{}, fmt.Errorf("aiff: unsupported AIFC compression %q", compression)
+		}
+	}
+	if channels < 1 {
+		return nil, beep.Format{}, fmt.Errorf("aiff: invalid channel count %d", channels)
+	}
+	if bits < 1 || bits > 32 {
+		return nil, beep.Format{}, fmt.Errorf("aiff: unsupported sample size of %d bits", bits)
+	}
+	if sampleRate < 1 || sampleRate > math.MaxInt32 {
+		return nil, beep.Format{}, fmt.Errorf("aiff: invalid sample rate %v", sampleRate)
+	}
+
+	// SSND starts with the offset of the first frame and a block size used for alignment
+	if ssnd.Size < 8 {
+		return nil, beep.Format{}, fmt.Errorf("aiff: SSND chunk too short")
+	}
+	var ssndHeader [8]byte
+	if _, err := r.Seek(ssnd.Offset, io.SeekStart); err != nil {
+		return nil, beep.Format{}, err
+	}
+	if _, err := io.ReadFull(r, ssndHeader[:]); err != nil {
+		return nil, beep.Format{}, fmt.Errorf("aiff: reading SSND chunk: %w", err)
+	}
+	start := ssnd.Offset + 8 + int64(binary.BigEndian.Uint32(ssndHeader[:]))
+	width := (bits + 7) / 8
+	frames = min(frames, int(max(ssnd.Offset+ssnd.Size-start, 0)/int64(channels*width)))
+
+	d, err := newPCMDecoder(r, start, frames, pcmLayout{channels: channels, width: width, bigEndian: bigEndian})
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("aiff: %w", err)
+	}
+	format := beep.Format{SampleRate: beep.SampleRate(math.Round(sampleRate)), NumChannels: min(d.layout.channels, 2), Precision: d.layout.width}
+	return newDownmix(d), format, nil
+}
+
+// Convert an 80-bit IEEE 754 extended precision float, as used for the AIFF sample rate
+func extendedToFloat(b []byte) float64 {
+	exponent := int(binary.BigEndian.Uint16(b[0:]) & 0x7FFF)
+	mantissa := binary.BigEndian.Uint64(b[2:])
+	if exponent == 0 && mantissa == 0 {
+		return 0
+	}
+	value := math.Ldexp(float64(mantissa), exponent-16383-63)
+	if b[0]&0x80 != 0 {
+		value = -value
+	}
+	return value
+}
@@ -0,0 +1,115 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+func TestExtendedToFloat(t *testing.T) {
+	tests := []struct {
+		hex  string
+		want float64
+	}{
+		{"400eac44000000000000", 44100},
+		{"400ebb80000000000000", 48000},
+		{"400dac44000000000000", 22050},
+		{"400bfa00000000000000", 8000},
+		{"400fbb80000000000000", 96000},
+		{"400ffa00000000000000", 128000},
+		{"3fff8000000000000000", 1},
+		{"3ffec000000000000000", 0.75},
+		{"c00eac44000000000000", -44100},
+		{"00000000000000000000", 0},
+	}
+	for _, test := range tests {
+		b, _ := hex.DecodeString(test.hex)
+		if got := extendedToFloat(b); got != test.want {
+			t.Errorf("%s: got %v, want %v", test.hex, got, test.want)
+		}
+	}
+}
+
+// Return an AIFF or AIFC file at 44.1 kHz of 16-bit frames in data with the given compression (AIFC only),
+// the SSND chunk has offset bytes of padding before them
+func aiffTestFile(form, compression string, channels, bits int, offset int, data []byte) []byte {
+	comm := binary.BigEndian.AppendUint16(nil, uint16(channels))
+	comm = binary.BigEndian.AppendUint32(comm, uint32(len(data)/max(channels*2, 1)))
+	comm = binary.BigEndian.AppendUint16(comm, uint16(bits))
+	rate, _ := hex.DecodeString("400eac44000000000000")
+	comm = append(comm, rate...)
+	if form == "AIFC" {
+		comm = append(append(comm, compression...), 0, 0) // and an empty name
+	}
+	ssnd := binary.BigEndian.AppendUint32(nil, uint32(offset))
+	ssnd = binary.BigEndian.AppendUint32(ssnd, 0)
+	ssnd = append(append(ssnd, make([]byte, offset)...), data...)
+
+	var body []byte
+	for _, chunk := range []struct {
+		id   string
+		data []byte
+	}{{"COMM", comm}, {"SSND", ssnd}} {
+		body = append(body, chunk.id...)
+		body = binary.BigEndian.AppendUint32(body, uint32(len(chunk.data)))
+		body = append(body, chunk.data...)
+		if len(chunk.data)%2 != 0 {
+			body = append(body, 0)
+		}
+	}
+	file := append([]byte("FORM"), binary.BigEndian.AppendUint32(nil, uint32(4+len(body)))...)
+	return append(append(file, form...), body...)
+}
+
+func TestDecodeAIFF(t *testing.T) {
+	bigEndian := []byte{0x40, 0x00, 0xc0, 0x00, 0x20, 0x00, 0xe0, 0x00} // 0.5, -0.5, 0.25, -0.25
+	littleEndian := []byte{0x00, 0x40, 0x00, 0xc0, 0x00, 0x20, 0x00, 0xe0}
+	tests := []struct {
+		name    string
+		file    []byte
+		want    [][2]float64
+		wantErr bool
+	}{
+		{"AIFF", aiffTestFile("AIFF", "", 2, 16, 0, bigEndian), [][2]float64{{0.5, -0.5}, {0.25, -0.25}}, false},
+		{"AIFF with an SSND offset", aiffTestFile("AIFF", "", 2, 16, 3, bigEndian), [][2]float64{{0.5, -0.5}, {0.25, -0.25}}, false},
+		{"AIFF mono", aiffTestFile("AIFF", "", 1, 16, 0, bigEndian), [][2]float64{{0.5, 0.5}, {-0.5, -0.5}, {0.25, 0.25}, {-0.25, -0.25}}, false},
+		{"AIFC twos", aiffTestFile("AIFC", "twos", 2, 16, 0, bigEndian), [][2]float64{{0.5, -0.5}, {0.25, -0.25}}, false},
+		{"AIFC sowt", aiffTestFile("AIFC", "sowt", 2, 16, 0, littleEndian), [][2]float64{{0.5, -0.5}, {0.25, -0.25}}, false},
+		{"AIFC compressed", aiffTestFile("AIFC", "ima4", 2, 16, 0, bigEndian), nil, true},
+		{"no sample size", aiffTestFile("AIFF", "", 2, 0, 0, bigEndian), nil, true},
+		{"no channels", aiffTestFile("AIFF", "", 0, 16, 0, bigEndian), nil, true},
+		{"truncated COMM", aiffTestFile("AIFF", "", 2, 16, 0, bigEndian)[:30], nil, true},
+	}
+	for _, test := range tests {
+		s, format, err := decodeAIFF(bytes.NewReader(test.file))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: err = %v, want an error: %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if format.SampleRate != 44100 || format.Precision != 2 || s.Len() != len(test.want) {
+			t.Errorf("%s: format %+v with %d frames, want 44100 Hz, 2 bytes and %d frames", test.name, format, s.Len(), len(test.want))
+			continue
+		}
+		got := make([][2]float64, 4)
+		n, _ := s.Stream(got)
+		if n != len(test.want) || !equalFrames(got[:n], test.want) {
+			t.Errorf("%s: streamed %v, want %v", test.name, got[:n], test.want)
+		}
+	}
+}
+
+func equalFrames(a, b [][2]float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !approxEqual(a[i][0], b[i][0], 1e-9) || !approxEqual(a[i][1], b[i][1], 1e-9) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,521 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// alacConfig is the ALACSpecificConfig ("magic cookie") of an Apple Lossless track
+type alacConfig struct {
+	FrameLength       uint32 // frames per packet, the last packet may have fewer
+	CompatibleVersion uint8
+	BitDepth          uint8
+	PB, MB, KB        uint8 // adaptive Rice coding parameters
+	NumChannels       uint8
+	MaxRun            uint16
+	MaxFrameBytes     uint32
+	AvgBitRate        uint32
+	SampleRate        uint32
+}
+
+// Speaker positions of the channels of an ALAC stream by channel count, in the order of its elements
+var alacChannelLayouts = [][]Channel{
+	1: {FrontCenter},
+	2: {FrontLeft, FrontRight},
+	3: {FrontCenter, FrontLeft, FrontRight},
+	4: {FrontCenter, FrontLeft, FrontRight, BackCenter},
+	5: {FrontCenter, FrontLeft, FrontRight, BackLeft, BackRight},
+	6: {FrontCenter, FrontLeft, FrontRight, BackLeft, BackRight, LowFrequency},
+	7: {FrontCenter, FrontLeft, FrontRight, BackLeft, BackRight, BackCenter, LowFrequency},
+	8: {FrontCenter, FrontLeftOfCenter, FrontRightOfCenter, FrontLeft, FrontRight, BackLeft, BackRight, LowFrequency},
+}
+
+// Element types of an ALAC packet
+const (
+	alacSCE = 0 // single channel
+	alacCPE = 1 // channel pair
+	alacCCE = 2 // coupling channel, unused by encoders
+	alacLFE = 3
+	alacDSE = 4 // data stream
+	alacPCE = 5 // program config, unused by encoders
+	alacFIL = 6 // fill
+	alacEND = 7
+)
+
+// Decode the Apple Lossless track of an M4A (MP4) file
+func decodeM4A(r io.ReadSeeker) (beep.StreamSeekCloser, beep.Format, error) {
+	moov, fileSize, err := readMP4Moov(r)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("m4a: %w", err)
+	}
+	track, err := findMP4AudioTrack(moov, fileSize)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("m4a: %w", err)
+	}
+	switch track.codec {
+	case "alac":
+	case "mp4a":
+		return nil, beep.Format{}, fmt.Errorf("m4a: AAC isn't supported, only Apple Lossless")
+	default:
+		return nil, beep.Format{}, fmt.Errorf("m4a: unsupported codec %q", track.codec)
+	}
+	config, err := readALACConfig(track.entry)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	d := &alacDecoder{r: r, config: config, packets: track.packets, frames: track.frames}
+	d.decoded = make([]float64, int(config.FrameLength)*int(config.NumChannels))
+	d.predictor = make([]int32, config.FrameLength)
+	for i := range d.mix {
+		d.mix[i] = make([]int32, config.FrameLength)
+		d.low[i] = make([]uint32, config.FrameLength)
+	}
+	format := beep.Format{SampleRate: beep.SampleRate(config.SampleRate), NumChannels: min(int(config.NumChannels), 2), Precision: (int(config.BitDepth) + 7) / 8}
+	return newDownmix(d), format, nil
+}
+
+// Read the magic cookie from the alac box of an alac sample entry
+func readALACConfig(entry []byte) (alacConfig, error) {
+	var config alacConfig
+	if len(entry) < 28 {
+		return config, fmt.Errorf("alac: sample entry too short")
+	}
+	skip := 28 // the fields of an audio sample entry, its boxes follow
+	switch binary.BigEndian.Uint16(entry[8:]) {
+	case 1: // QuickTime sound description versions
+		skip += 16
+	case 2:
+		skip += 36
+	}
+	if len(entry) < skip {
+		return config, fmt.Errorf("alac: sample entry too short")
+	}
+	boxes := parseMP4Boxes(entry[skip:])
+	cookie := findMP4Box(boxes, "alac")
+	if cookie == nil {
+		cookie = findMP4Box(boxes, "wave", "alac") // QuickTime files wrap it in a wave box
+	}
+	if len(cookie) < 4+binary.Size(config) {
+		return config, fmt.Errorf("alac: missing magic cookie")
+	}
+	binary.Read(bytes.NewReader(cookie[4:]), binary.BigEndian, &config) // after the version and flags
+	switch {
+	case config.NumChannels < 1 || int(config.NumChannels) >= len(alacChannelLayouts):
+		return config, fmt.Errorf("alac: unsupported channel count %d", config.NumChannels)
+	case config.BitDepth != 16 && config.BitDepth != 20 && config.BitDepth != 24 && config.BitDepth != 32:
+		return config, fmt.Errorf("alac: unsupported bit depth %d", config.BitDepth)
+	case config.FrameLength == 0 || config.FrameLength > 1<<16:
+		return config, fmt.Errorf("alac: invalid frame length %d", config.FrameLength)
+	case config.KB == 0:
+		return config, fmt.Errorf("alac: invalid Rice parameter limit")
+	case config.SampleRate == 0:
+		return config, fmt.Errorf("alac: invalid sample rate")
+	}
+	return config, nil
+}
+
+// alacDecoder streams every channel of an ALAC track, it's played through a Downmix
+type alacDecoder struct {
+	r       io.ReadSeeker
+	config  alacConfig
+	packets []mp4Packet
+	frames  int
+	packet  int // next packet to decode
+	pos     int
+	err     error
+
+	data          []byte    // compressed packet
+	decoded       []float64 // interleaved frames of the last decoded packet
+	decodedFrames int
+	read          int // frames of decoded that were streamed
+
+	predictor []int32 // residuals, then prediction errors of a channel
+	mix       [2][]int32
+	low       [2][]uint32 // low bytes shifted out of the samples before compression
+}
+
+func (d *alacDecoder) channels() []Channel {
+	return alacChannelLayouts[d.config.NumChannels]
+}
+
+func (d *alacDecoder) streamFrames(samples []float64) (n int, ok bool) {
+	channels := int(d.config.NumChannels)
+	for n < len(samples)/channels {
+		if d.read == d.decodedFrames {
+			if d.err != nil || d.packet >= len(d.packets) {
+				break
+			}
+			if d.err = d.decodeNext(); d.err != nil {
+				break
+			}
+			continue
+		}
+		k := min(len(samples)/channels-n, d.decodedFrames-d.read)
+		copy(samples[n*channels:(n+k)*channels], d.decoded[d.read*channels:])
+		n += k
+		d.read += k
+		d.pos += k
+	}
+	return n, n > 0
+}
+
+// Read and decode the next packet into decoded
+func (d *alacDecoder) decodeNext() error {
+	p := d.packets[d.packet]
+	if cap(d.data) < p.size {
+		d.data = make([]byte, p.size)
+	}
+	d.data = d.data[:p.size]
+	if _, err := d.r.Seek(p.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("alac: %w", err)
+	}
+	if _, err := io.ReadFull(d.r, d.data); err != nil {
+		return fmt.Errorf("alac: reading packet %d: %w", d.packet, err)
+	}
+	frames, err := d.decodePacket(d.data)
+	if err != nil {
+		return fmt.Errorf("alac: packet %d: %w", d.packet, err)
+	}
+	d.decodedFrames = min(frames, p.frames)
+	d.read = 0
+	d.pos = p.start
+	d.packet++
+	return nil
+}
+
+// Decode the elements of a packet, returns the number of frames
+func (d *alacDecoder) decodePacket(data []byte) (frames int, err error) {
+	b := &bitReader{data: data}
+	channels := int(d.config.NumChannels)
+	for channel := 0; channel < channels; {
+		switch tag := b.read(3); tag {
+		case alacSCE, alacLFE, alacCPE:
+			count := 1
+			if tag == alacCPE {
+				count = 2
+			}
+			if channel+count > channels {
+				return 0, fmt.Errorf("more channels than the %d of the track", channels)
+			}
+			if frames, err = d.decodeElement(b, channel, count); err != nil {
+				return 0, err
+			}
+			channel += count
+		case alacDSE:
+			b.read(4) // element instance tag
+			aligned := b.read(1)
+			size := b.read(8)
+			if size == 255 {
+				size += b.read(8)
+			}
+			if aligned != 0 {
+				b.align()
+			}
+			b.pos += 8 * int(size)
+		case alacFIL:
+			size := b.read(4)
+			if size == 15 {
+				size += b.read(8) - 1
+			}
+			b.pos += 8 * int(size)
+		case alacEND:
+			return 0, fmt.Errorf("ended after %d of %d channels", channel, channels)
+		default:
+			return 0, fmt.Errorf("unsupported element type %d", tag)
+		}
+		if b.pos > 8*len(data) {
+			return 0, fmt.Errorf("truncated")
+		}
+	}
+	return frames, nil
+}
+
+// Decode a single channel (count 1) or channel pair (count 2) element into the decoded frames at channel
+func (d *alacDecoder) decodeElement(b *bitReader, channel, count int) (int, error) {
+	b.read(4) // element instance tag
+	if b.read(12) != 0 {
+		return 0, fmt.Errorf("invalid element header")
+	}
+	header := b.read(4)
+	partial, bytesShifted, escape := header>>3 != 0, int(header>>1&3), header&1 != 0
+	numSamples := int(d.config.FrameLength)
+	if partial {
+		numSamples = int(b.read(32))
+	}
+	if numSamples > int(d.config.FrameLength) {
+		return 0, fmt.Errorf("%d frames in a packet of at most %d", numSamples, d.config.FrameLength)
+	}
+	bitDepth := int(d.config.BitDepth)
+	var mixBits, mixRes int32
+	if !escape {
+		chanBits := bitDepth - 8*bytesShifted + count - 1 // the side channel of a pair needs an extra bit
+		if bytesShifted >= 3 || chanBits < 1 || chanBits > 32+count-1 {
+			return 0, fmt.Errorf("invalid shift of %d bytes for %d bit samples", bytesShifted, bitDepth)
+		}
+		mixBits, mixRes = int32(b.read(8)), int32(int8(b.read(8)))
+		var modes, denShifts, pbFactors [2]uint32
+		var coefs [2][]int16
+		for i := range count {
+			header := b.read(8)
+			modes[i], denShifts[i] = header>>4, header&0xf
+			header = b.read(8)
+			pbFactors[i] = header >> 5
+			coefs[i] = make([]int16, header&0x1f)
+			for k := range coefs[i] {
+				coefs[i][k] = int16(b.read(16))
+			}
+		}
+		shifted := bitReader{data: b.data, pos: b.pos} // the low bytes precede the residuals
+		b.pos += 8 * bytesShifted * count * numSamples
+		for i := range count {
+			pb := uint32(d.config.PB) * pbFactors[i] / 4
+			if err := d.decompress(b, d.predictor[:numSamples], pb, chanBits); err != nil {
+				return 0, err
+			}
+			if modes[i] != 0 {
+				unpredictDelta(d.predictor[:numSamples], chanBits)
+			}
+			unpredict(d.predictor[:numSamples], d.mix[i][:numSamples], coefs[i], chanBits, denShifts[i])
+		}
+		for j := range numSamples {
+			for i := range count {
+				d.low[i][j] = 0
+				if bytesShifted > 0 {
+					d.low[i][j] = shifted.read(8 * bytesShifted)
+				}
+			}
+		}
+	} else { // uncompressed
+		bytesShifted = 0
+		for j := range numSamples {
+			for i := range count {
+				d.mix[i][j] = signExtend(b.read(bitDepth), bitDepth)
+				d.low[i][j] = 0
+			}
+		}
+	}
+
+	channels := int(d.config.NumChannels)
+	scale := 1 / float64(uint64(1)<<(bitDepth-1))
+	for j := range numSamples {
+		var v [2]int32
+		v[0] = d.mix[0][j]
+		if count == 2 {
+			v[1] = d.mix[1][j]
+			if mixRes != 0 { // mid/side
+				v[0] = d.mix[0][j] + d.mix[1][j] - (mixRes*d.mix[1][j])>>mixBits
+				v[1] = v[0] - d.mix[1][j]
+			}
+		}
+		for i := range count {
+			sample := v[i]<<(8*bytesShifted) | int32(d.low[i][j])
+			d.decoded[j*channels+channel+i] = float64(sample) * scale
+		}
+	}
+	return numSamples, nil
+}
+
+// Decode the adaptive Golomb-Rice coded residuals of a channel into pc
+func (d *alacDecoder) decompress(b *bitReader, pc []int32, pb uint32, chanBits int) error {
+	const (
+		qbShift       = 9
+		maxPrefix     = 9
+		runEscapeBits = 16
+	)
+	mb := uint32(d.config.MB)
+	kb := uint32(d.config.KB)
+	wb := uint32(1)<<kb - 1
+	escapeBits := min(chanBits, 32)
+	zmode := uint32(0)
+	for c := 0; c < len(pc); {
+		if b.pos >= 8*len(b.data) {
+			return fmt.Errorf("residuals truncated")
+		}
+		k := min(uint32(31-bits.LeadingZeros32(mb>>qbShift+3)), kb)
+		n := b.readRice(k, uint32(1)<<k-1, maxPrefix, escapeBits)
+		value := n + zmode
+		pc[c] = int32((value + 1) >> 1) // the lowest bit is the sign
+		if value&1 != 0 {
+			pc[c] = -pc[c]
+		}
+		c++
+
+		mb = pb*(n+zmode) + mb - (pb*mb)>>qbShift
+		if n > 0xffff {
+			mb = 0xffff
+		}
+		zmode = 0
+		if mb<<2 < 1<<qbShift && c < len(pc) { // a run of zeros follows
+			zmode = 1
+			k := uint32(bits.LeadingZeros32(mb)) - 24 + (mb+16)>>6
+			run := int(b.readRice(k, (uint32(1)<<k-1)&wb, maxPrefix, runEscapeBits))
+			if c+run > len(pc) {
+				return fmt.Errorf("run of %d zeros past the end of the frame", run)
+			}
+			clear(pc[c : c+run])
+			c += run
+			if run >= 0xffff {
+				zmode = 0
+			}
+			mb = 0
+		}
+	}
+	return nil
+}
+
+// Undo the first order prediction of mode 15 in place, which precedes the adaptive prediction
+func unpredictDelta(pc []int32, chanBits int) {
+	for j := 1; j < len(pc); j++ {
+		pc[j] = signExtend(uint32(pc[j]+pc[j-1]), chanBits)
+	}
+}
+
+// Reconstruct the samples of a channel from the prediction errors in pc with the adaptive FIR predictor,
+// which adapts coefs as it goes
+func unpredict(pc, out []int32, coefs []int16, chanBits int, denShift uint32) {
+	if len(pc) == 0 {
+		return
+	}
+	order := len(coefs)
+	switch order {
+	case 0: // no prediction
+		copy(out, pc)
+		return
+	case 31: // first order only
+		copy(out, pc)
+		unpredictDelta(out, chanBits)
+		return
+	}
+	out[0] = pc[0]
+	for j := 1; j <= order && j < len(pc); j++ {
+		out[j] = signExtend(uint32(pc[j]+out[j-1]), chanBits)
+	}
+	denHalf := int32(0)
+	if denShift > 0 {
+		denHalf = 1 << (denShift - 1)
+	}
+	for j := order + 1; j < len(pc); j++ {
+		top := out[j-order-1]
+		var sum int32
+		for k := range order {
+			sum += int32(coefs[k]) * (out[j-1-k] - top)
+		}
+		del := pc[j]
+		out[j] = signExtend(uint32(del+top+(sum+denHalf)>>denShift), chanBits)
+
+		// Move the coefficients towards the error, nearest samples last
+		sign := signOf(del)
+		for k := order - 1; k >= 0 && sign != 0; k-- {
+			dd := top - out[j-1-k]
+			sgn := signOf(dd)
+			coefs[k] -= int16(sgn * sign)
+			del -= int32(order-k) * ((sign * sgn * dd) >> denShift)
+			if del*sign <= 0 {
+				break
+			}
+		}
+	}
+}
+
+func signOf(v int32) int32 {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+// Interpret the low n bits of v as a two's complement number
+// NOTE: the 33 bit side channel of an unshifted 32 bit pair wraps around in 32 bits like in Apple's decoder,
+// the wrapped value still restores the channels
+func signExtend(v uint32, n int) int32 {
+	if n >= 32 {
+		return int32(v)
+	}
+	shift := 32 - n
+	return int32(v<<shift) >> shift
+}
+
+func (d *alacDecoder) Err() error    { return d.err }
+func (d *alacDecoder) Len() int      { return d.frames }
+func (d *alacDecoder) Position() int { return d.pos }
+func (d *alacDecoder) Close() error  { return nil } // the reader is owned by the caller of Decode
+
+func (d *alacDecoder) Seek(p int) error {
+	if p < 0 || p > d.frames {
+		return fmt.Errorf("alac: seek position %v out of range [%v, %v]", p, 0, d.frames)
+	}
+	d.packet = sort.Search(len(d.packets), func(i int) bool {
+		return d.packets[i].start+d.packets[i].frames > p
+	})
+	d.decodedFrames, d.read, d.pos, d.err = 0, 0, p, nil // a packet that failed to decode may be skipped now
+	if d.packet == len(d.packets) {
+		return nil
+	}
+	if err := d.decodeNext(); err != nil { // decode the packet containing p and skip to it
+		return err
+	}
+	d.read = min(p-d.pos, d.decodedFrames)
+	d.pos += d.read
+	return nil
+}
+
+// bitReader reads big-endian bit fields, reading past the end of data returns zeros
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+}
+
+// Return the next 32 bits without advancing
+func (b *bitReader) peek32() uint32 {
+	var window uint64
+	for i := range 5 {
+		window <<= 8
+		if at := b.pos>>3 + i; at < len(b.data) {
+			window |= uint64(b.data[at])
+		}
+	}
+	return uint32(window << (b.pos & 7) >> 8)
+}
+
+// Read n bits, up to 32
+func (b *bitReader) read(n int) uint32 {
+	if n == 0 {
+		return 0
+	}
+	v := b.peek32() >> (32 - n)
+	b.pos += n
+	return v
+}
+
+func (b *bitReader) align() {
+	b.pos = (b.pos + 7) &^ 7
+}
+
+// Read a Rice code with parameter k and modulus m (usually 2^k-1): a unary prefix of ones, then k bits
+// where values below 2 only take k-1. A prefix of maxPrefix ones escapes a value of escapeBits raw bits.
+func (b *bitReader) readRice(k, m uint32, maxPrefix, escapeBits int) uint32 {
+	prefix := bits.LeadingZeros32(^b.peek32())
+	if prefix >= maxPrefix {
+		b.pos += maxPrefix
+		return b.read(escapeBits)
+	}
+	b.pos += prefix + 1
+	if k < 2 { // values below 2 take k-1 bits, so there are none to read
+		return uint32(prefix) * m
+	}
+	v := b.read(int(k))
+	if v < 2 {
+		b.pos--
+		return uint32(prefix) * m
+	}
+	return uint32(prefix)*m + v - 1
+}
@@ -0,0 +1,69 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestReadRice(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		k       uint32
+		want    uint32
+		wantPos int // bits read
+	}{
+		{"k=0", []byte{0b11000000}, 0, 0, 3},
+		{"k=0 no prefix", []byte{0b00000000}, 0, 0, 1},
+		{"k=1", []byte{0b11011111}, 1, 2, 3},
+		{"k=3 below 2", []byte{0b10001000}, 3, 7, 4}, // only k-1 bits
+		{"k=3", []byte{0b10101000}, 3, 11, 5},
+		{"escape", []byte{0b11111111, 0b10101010}, 3, 42, 16}, // maxPrefix ones and 7 bits
+	}
+	for _, test := range tests {
+		b := &bitReader{data: test.data}
+		if got := b.readRice(test.k, uint32(1)<<test.k-1, 9, 7); got != test.want || b.pos != test.wantPos {
+			t.Errorf("%s: got %d after %d bits, want %d after %d", test.name, got, b.pos, test.want, test.wantPos)
+		}
+	}
+}
+
+// Return an alac sample entry with config as its magic cookie
+func alacTestEntry(config alacConfig) []byte {
+	var cookie bytes.Buffer
+	cookie.Write(make([]byte, 4)) // version and flags
+	binary.Write(&cookie, binary.BigEndian, config)
+	return append(make([]byte, 28), mp4TestBox("alac", cookie.Bytes())...)
+}
+
+func TestReadALACConfig(t *testing.T) {
+	valid := alacConfig{FrameLength: 4096, BitDepth: 16, PB: 40, MB: 10, KB: 14, NumChannels: 2, MaxRun: 255, SampleRate: 44100}
+	tests := []struct {
+		name    string
+		modify  func(c *alacConfig)
+		wantErr string
+	}{
+		{"valid", func(c *alacConfig) {}, ""},
+		{"no Rice parameter limit", func(c *alacConfig) { c.KB = 0 }, "invalid Rice parameter limit"},
+		{"no channels", func(c *alacConfig) { c.NumChannels = 0 }, "unsupported channel count"},
+		{"12 bits", func(c *alacConfig) { c.BitDepth = 12 }, "unsupported bit depth"},
+		{"no frame length", func(c *alacConfig) { c.FrameLength = 0 }, "invalid frame length"},
+		{"no sample rate", func(c *alacConfig) { c.SampleRate = 0 }, "invalid sample rate"},
+	}
+	for _, test := range tests {
+		config := valid
+		test.modify(&config)
+		got, err := readALACConfig(alacTestEntry(config))
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: err = %v, want %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != config {
+			t.Errorf("%s: got %+v, %v, want %+v", test.name, got, err, config)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package player
+
+import (
+	"time"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/effects"
+)
+
+const MaxCrossfade = 12 * time.Second
+
+// chain is the streamer a Player hands to its Output, it plays the current track and continues
+// with the next track without a gap, or crossfades into it when crossfade is set
+// NOTE: guarded by the Output lock, the callbacks are called with it held
+type chain struct {
+	mixer         beep.Mixer
+	current       Track
+	currentStream beep.Streamer // current track's output as added to the mixer
+	next          Track         // set by SetNext, nil until ready
+	outgoing      Track         // fading out after a crossfade
+	crossfade     time.Duration // 0 plays tracks back to back (gapless)
+	onSwitch      func(next Track)
+	onEnd         func() // the last track played its last sample
+	onError       func(err error)
+	onPosition    func(current Track) // every positionInterval of played audio
+	sincePosition int                 // samples played since onPosition was last called
+}
+
+func newChain(track Track) *chain {
+	c := &chain{}
+	c.mixer.KeepAlive(false)
+	c.setCurrent(track)
+	return c
+}
+
+// Make track the current track and add its output to the mixer
+func (c *chain) setCurrent(track Track) {
+	c.current, c.currentStream = track, c.output(track)
+	c.mixer.Add(c.currentStream)
+}
+
+// Return the track's output which notifies the chain once the track played its last sample
+func (c *chain) output(track Track) beep.Streamer {
+	return beep.Seq(track, beep.Callback(func() {
+		if err := track.Err(); err != nil && c.onError != nil {
+			c.onError(err)
+		}
+		if track != c.current { // faded out
+			track.Close()
+			if c.outgoing == track {
+				c.outgoing = nil
+			}
+			return
+		}
+		if c.next != nil {
+			return // the chain continues with the next track
+		}
+		if c.onEnd != nil {
+			c.onEnd()
+		}
+	}))
+}
+
+// Switch to the prepared track, crossfading over fadeLen samples if it's more than 0
+func (c *chain) advance(fadeLen int) {
+	previous, next := c.current, c.next
+	c.next = nil
+	if fadeLen > 0 {
+		if c.outgoing != nil { // still fading out from the last switch, removed by mixer.Clear
+			c.outgoing.Close()
+		}
+		outgoing := c.currentStream
+		c.outgoing = previous
+		c.current, c.currentStream = next, c.output(next)
+		c.mixer.Clear()
+		c.mixer.Add(
+			effects.Transition(outgoing, fadeLen, 1, 0, fadeOutEqualPower),
+			effects.Transition(c.currentStream, fadeLen, 0, 1, effects.TransitionEqualPower),
+		)
+	} else {
+		previous.Close() // already played its last sample
+		c.setCurrent(next)
+	}
+	if c.onSwitch != nil {
+		c.onSwitch(next)
+	}
+}
+
+// Mirror of effects.TransitionEqualPower for the fading out track so the summed power stays constant
+func fadeOutEqualPower(percent float64) float64 {
+	return 1 - effects.TransitionEqualPower(1-percent)
+}
+
+func (c *chain) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = c.stream(samples)
+	c.sincePosition += n
+	if c.onPosition != nil && c.current != nil && c.sincePosition >= SampleRate.N(positionInterval) {
+		c.sincePosition = 0
+		c.onPosition(c.current)
+	}
+	return n, ok
+}
+
+func (c *chain) stream(samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) {
+		// Start crossfading once the current track is within the crossfade length of its end
+		toStream := samples[n:]
+		fadeLen := SampleRate.N(c.crossfade)
+		if c.next != nil && fadeLen > 0 {
+			remaining := c.current.Remaining()
+			if remaining <= fadeLen {
+				c.advance(max(remaining, 1))
+				continue
+			}
+			toStream = toStream[:min(len(toStream), remaining-fadeLen)]
+		}
+
+		sn, sok := c.mixer.Stream(toStream)
+		n += sn
+		if sok && sn > 0 {
+			continue
+		}
+		if c.next == nil { // nothing left to play
+			return n, n > 0
+		}
+		c.advance(0) // gapless, the next track continues right after the last sample
+	}
+	return n, true
+}
+
+func (c *chain) Err() error {
+	return nil
+}
+
+// Close every track of the chain, it must not be streamed afterward
+func (c *chain) close() {
+	for _, track := range []Track{c.current, c.next, c.outgoing} {
+		if track != nil {
+			track.Close()
+		}
+	}
+	c.current, c.next, c.outgoing = nil, nil, nil
+}
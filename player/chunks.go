@@ -0,0 +1,98 @@
+package player
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Chunk is a chunk of an AIFF or WAV file, its data is Size bytes at Offset
+type Chunk struct {
+	ID     string
+	Offset int64
+	Size   int64
+}
+
+// ReadChunks lists the chunks of an AIFF or WAV (including RF64 and BW64) file and returns its form type,
+// "AIFF", "AIFC" or "WAVE"
+func ReadChunks(r io.ReadSeeker) (form string, chunks []Chunk, err error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return "", nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return "", nil, err
+	}
+	var header [12]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return "", nil, fmt.Errorf("reading header: %w", err)
+	}
+	container, form := string(header[:4]), string(header[8:12])
+	var order binary.ByteOrder = binary.LittleEndian
+	switch {
+	case container == "FORM" && (form == "AIFF" || form == "AIFC"):
+		order = binary.BigEndian
+	case (container == "RIFF" || container == "RF64" || container == "BW64") && form == "WAVE":
+	default:
+		return "", nil, fmt.Errorf("not an AIFF or WAV file")
+	}
+
+	var ds64 map[string]int64 // 64-bit chunk sizes of RF64 files, whose 32-bit sizes are 0xFFFFFFFF
+	for offset := int64(len(header)); offset+8 <= end; {
+		var chunkHeader [8]byte
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return "", nil, err
+		}
+		if _, err := io.ReadFull(r, chunkHeader[:]); err != nil {
+			return "", nil, fmt.Errorf("reading chunk header: %w", err)
+		}
+		c := Chunk{
+			ID:     string(chunkHeader[:4]),
+			Offset: offset + 8,
+			Size:   int64(order.Uint32(chunkHeader[4:])),
+		}
+		if size, ok := ds64[c.ID]; ok && c.Size == math.MaxUint32 {
+			c.Size = size
+		}
+		c.Size = min(c.Size, end-c.Offset) // e.g. recordings that were cut off
+		if c.ID == "ds64" && container != "RIFF" {
+			if ds64, err = readDS64(r, c); err != nil {
+				return "", nil, err
+			}
+		}
+		chunks = append(chunks, c)
+		offset = c.Offset + c.Size + c.Size%2 // chunks are padded to an even size
+	}
+	return form, chunks, nil
+}
+
+// Read the chunk sizes of an RF64 ds64 chunk, the size of the data chunk and of any in its table
+func readDS64(r io.ReadSeeker, c Chunk) (map[string]int64, error) {
+	data, err := ReadChunk(r, c)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 28 {
+		return nil, fmt.Errorf("ds64 chunk too short")
+	}
+	sizes := map[string]int64{"data": int64(binary.LittleEndian.Uint64(data[8:]))}
+	table := int(binary.LittleEndian.Uint32(data[24:]))
+	for i := 0; i < table && 28+12*(i+1) <= len(data); i++ {
+		entry := data[28+12*i:]
+		sizes[string(entry[:4])] = int64(binary.LittleEndian.Uint64(entry[4:]))
+	}
+	return sizes, nil
+}
+
+// ReadChunk returns the data of chunk c
+func ReadChunk(r io.ReadSeeker, c Chunk) ([]byte, error) {
+	if _, err := r.Seek(c.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data := make([]byte, c.Size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, fmt.Errorf("reading %q chunk: %w", c.ID, err)
+	}
+	return data, nil
+}
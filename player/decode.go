@@ -0,0 +1,129 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/flac"
+	"github.com/gopxl/beep/v2/mp3"
+	"github.com/gopxl/beep/v2/vorbis"
+)
+
+// Read the MagicBytes of the file to determine the fileType and return the file extension (e.g. ".wav" for wave files)
+func DetectType(r io.ReadSeeker) (string, error) {
+	const headerSize = 64 // enough for the first Ogg page's codec identification
+	header := make([]byte, headerSize)
+
+	// Read the first 64 bytes.
+	n, err := io.ReadFull(r, header)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", fmt.Errorf("error reading magic bytes: %w", err)
+	}
+	header = header[:n]
+
+	// Determine file type from header.
+	fileType := determineFileType(header)
+
+	// Reset reader position.
+	_, err = r.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", fmt.Errorf("failed to reset reader position: %w", err)
+	}
+
+	return fileType, nil
+}
+
+// Helper method to get the relevant file extension based on the magic bytes of the input bytes
+func determineFileType(header []byte) string {
+	switch {
+	case len(header) >= 12 && (string(header[:4]) == "RIFF" || string(header[:4]) == "RF64" || string(header[:4]) == "BW64") && string(header[8:12]) == "WAVE":
+		return ".wav"
+	case len(header) >= 12 && string(header[:4]) == "FORM" && (string(header[8:12]) == "AIFF" || string(header[8:12]) == "AIFC"):
+		return ".aiff"
+	case len(header) >= 3 && string(header[:3]) == "ID3":
+		return ".mp3"
+	case len(header) >= 2 && header[0] == 0xFF && (header[1]&0xF6) == 0xF2:
+		return ".mp3"
+	case len(header) >= 4 && string(header[:4]) == "fLaC":
+		return ".flac"
+	case len(header) >= 8 && string(header[4:8]) == "ftyp":
+		return ".m4a"
+	case len(header) >= 4 && string(header[:4]) == "OggS":
+		if isOggOpus(header) {
+			return ".opus"
+		}
+		return ".ogg"
+	default:
+		log.Println("Could not determine audio type by magic bytes")
+		return ""
+	}
+}
+
+// Report whether the first packet of an Ogg stream is an OpusHead (RFC 7845), Vorbis starts with "\x01vorbis" instead
+func isOggOpus(header []byte) bool {
+	if len(header) < 27 {
+		return false
+	}
+	start := 27 + int(header[26]) // the packet follows the page's segment table
+	return len(header) >= start+8 && string(header[start:start+8]) == "OpusHead"
+}
+
+type seekableReadCloser struct {
+	io.ReadSeeker
+}
+
+func (s *seekableReadCloser) Close() error {
+	return nil // no-op; the underlying file is closed by its owner (e.g. the queue)
+}
+
+// Pick a decoder for r based on its magic bytes and return the decoded stream, its format and audio type
+func Decode(r io.ReadSeeker) (beep.StreamSeekCloser, beep.Format, string, error) {
+	var streamer beep.StreamSeekCloser
+	var format beep.Format
+
+	audioType, err := DetectType(r)
+	if err != nil {
+		return nil, format, "", err
+	}
+
+	// Wrap r in a closer to satisfy mp3 decoder
+	rc := &seekableReadCloser{r}
+
+	switch audioType {
+	case ".mp3":
+		log.Println("Using mp3 decoder")
+		streamer, format, err = mp3.Decode(rc)
+	case ".wav":
+		log.Println("Using wav decoder")
+		streamer, format, err = decodeWAV(r)
+	case ".flac":
+		log.Println("Using flac decoder")
+		streamer, format, err = flac.Decode(rc)
+	case ".ogg":
+		log.Println("Using vorbis decoder")
+		streamer, format, err = vorbis.Decode(rc)
+	case ".aiff":
+		log.Println("Using aiff decoder")
+		streamer, format, err = decodeAIFF(r)
+	case ".m4a":
+		log.Println("Using alac decoder")
+		streamer, format, err = decodeM4A(r)
+	case ".opus":
+		log.Println("Using opus decoder")
+		streamer, format, err = decodeOpus(r)
+	default:
+		return nil, format, audioType, fmt.Errorf("no decoder available for %v", audioType)
+	}
+
+	if err != nil {
+		return nil, format, audioType, fmt.Errorf("decoder failed for %v: %v", audioType, err)
+	}
+	if format.NumChannels > 2 { // only our own decoders downmix, see Downmix
+		log.Printf("Playing only the first two of %d channels", format.NumChannels)
+		format.NumChannels = 2
+	}
+	return streamer, format, audioType, nil
+}
@@ -0,0 +1,230 @@
+package player
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+)
+
+// Channel is the speaker position of a channel, as in WAVE_FORMAT_EXTENSIBLE channel masks
+type Channel uint32
+
+const (
+	FrontLeft Channel = 1 << iota
+	FrontRight
+	FrontCenter
+	LowFrequency
+	BackLeft
+	BackRight
+	FrontLeftOfCenter
+	FrontRightOfCenter
+	BackCenter
+	SideLeft
+	SideRight
+)
+
+func (c Channel) String() string {
+	switch c {
+	case FrontLeft:
+		return "L"
+	case FrontRight:
+		return "R"
+	case FrontCenter:
+		return "C"
+	case LowFrequency:
+		return "LFE"
+	case BackLeft:
+		return "Lb"
+	case BackRight:
+		return "Rb"
+	case FrontLeftOfCenter:
+		return "Lc"
+	case FrontRightOfCenter:
+		return "Rc"
+	case BackCenter:
+		return "Cb"
+	case SideLeft:
+		return "Ls"
+	case SideRight:
+		return "Rs"
+	default:
+		return "?" // e.g. height channels or more channels than the mask has positions
+	}
+}
+
+// Channel masks of files that don't specify one, by channel count
+var defaultChannelMasks = map[int]Channel{
+	1: FrontCenter,
+	2: FrontLeft | FrontRight,
+	3: FrontLeft | FrontRight | FrontCenter,
+	4: FrontLeft | FrontRight | BackLeft | BackRight,
+	5: FrontLeft | FrontRight | FrontCenter | BackLeft | BackRight,
+	6: FrontLeft | FrontRight | FrontCenter | LowFrequency | BackLeft | BackRight, // 5.1
+	7: FrontLeft | FrontRight | FrontCenter | LowFrequency | BackLeft | BackRight | BackCenter,
+	8: FrontLeft | FrontRight | FrontCenter | LowFrequency | BackLeft | BackRight | SideLeft | SideRight, // 7.1
+}
+
+// Return the speaker position of each of count channels, which are in the order of the mask's bits
+func channelLayout(count int, mask uint32) []Channel {
+	positions := Channel(mask)
+	if positions == 0 {
+		positions = defaultChannelMasks[count]
+	}
+	channels := make([]Channel, count)
+	for i := range channels {
+		channels[i] = positions & -positions // lowest bit, 0 once the mask ran out
+		positions &^= channels[i]
+	}
+	return channels
+}
+
+// Matrix holds the left and right output gain of every input channel
+type Matrix [][2]float64
+
+// ITUDownmix returns the ITU-R BS.775 stereo downmix of channels: center and surround channels are folded in
+// at -3 dB and LFE is dropped, scaled down so the downmix can't clip
+func ITUDownmix(channels []Channel) Matrix {
+	m := make(Matrix, len(channels))
+	if len(channels) == 1 { // mono plays on both sides
+		m[0] = [2]float64{1, 1}
+		return m
+	}
+	const minus3dB = math.Sqrt2 / 2
+	var sum [2]float64
+	for i, channel := range channels {
+		switch channel {
+		case FrontLeft, FrontLeftOfCenter:
+			m[i] = [2]float64{1, 0}
+		case FrontRight, FrontRightOfCenter:
+			m[i] = [2]float64{0, 1}
+		case FrontCenter, BackCenter:
+			m[i] = [2]float64{minus3dB, minus3dB}
+		case BackLeft, SideLeft:
+			m[i] = [2]float64{minus3dB, 0}
+		case BackRight, SideRight:
+			m[i] = [2]float64{0, minus3dB}
+		case LowFrequency:
+		default:
+			m[i] = [2]float64{minus3dB / 2, minus3dB / 2}
+		}
+		sum[0] += m[i][0]
+		sum[1] += m[i][1]
+	}
+	if scale := max(sum[0], sum[1]); scale > 1 {
+		for i := range m {
+			m[i][0] /= scale
+			m[i][1] /= scale
+		}
+	}
+	return m
+}
+
+// multichannel is a decoder streaming every channel of a file, interleaved
+type multichannel interface {
+	channels() []Channel
+	streamFrames(samples []float64) (n int, ok bool) // len(samples) is a multiple of the channel count
+	Err() error
+	Len() int
+	Position() int
+	Seek(p int) error
+	Close() error
+}
+
+// Downmix plays a multichannel decoder in stereo through a matrix that can be changed while playing,
+// and keeps the latest frames of every channel for visualizations
+// NOTE: its methods are safe to call from any goroutine, besides Stream and Seek which are called by the Output
+type Downmix struct {
+	src      multichannel
+	channels []Channel
+	buf      []float64
+
+	mu      sync.Mutex
+	matrix  Matrix
+	ring    []float32 // ringFrames interleaved frames
+	written int
+}
+
+func newDownmix(src multichannel) *Downmix {
+	channels := src.channels()
+	return &Downmix{
+		src:      src,
+		channels: channels,
+		matrix:   ITUDownmix(channels),
+		ring:     make([]float32, ringFrames*len(channels)),
+	}
+}
+
+func (d *Downmix) Stream(samples [][2]float64) (n int, ok bool) {
+	count := len(d.channels)
+	if len(d.buf) < len(samples)*count {
+		d.buf = make([]float64, len(samples)*count)
+	}
+	n, ok = d.src.streamFrames(d.buf[:len(samples)*count])
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for i := range n {
+		frame := d.buf[i*count : (i+1)*count]
+		var left, right float64
+		for ch, v := range frame {
+			left += v * d.matrix[ch][0]
+			right += v * d.matrix[ch][1]
+			d.ring[(d.written%ringFrames)*count+ch] = float32(v)
+		}
+		d.written++
+		samples[i] = [2]float64{left, right}
+	}
+	return n, ok
+}
+
+func (d *Downmix) Err() error    { return d.src.Err() }
+func (d *Downmix) Len() int      { return d.src.Len() }
+func (d *Downmix) Position() int { return d.src.Position() }
+func (d *Downmix) Close() error  { return d.src.Close() }
+
+// Seek the decoder to p and clear the latest frames, which don't lead up to p anymore
+func (d *Downmix) Seek(p int) error {
+	if err := d.src.Seek(p); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	clear(d.ring)
+	d.written = 0
+	return nil
+}
+
+// Channels returns the speaker position of every channel of the file
+func (d *Downmix) Channels() []Channel {
+	return slices.Clone(d.channels)
+}
+
+// Matrix returns the current downmix matrix
+func (d *Downmix) Matrix() Matrix {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return slices.Clone(d.matrix)
+}
+
+// SetMatrix changes the downmix, it needs a row for every channel
+func (d *Downmix) SetMatrix(m Matrix) error {
+	if len(m) != len(d.channels) {
+		return fmt.Errorf("downmix: matrix has %d rows for %d channels", len(m), len(d.channels))
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.matrix = slices.Clone(m)
+	return nil
+}
+
+// ReadChannel fills dst with the most recently decoded samples of channel ch, oldest first
+func (d *Downmix) ReadChannel(ch int, dst []float32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	count := len(d.channels)
+	start := ((d.written-len(dst))%ringFrames + ringFrames) % ringFrames
+	for i := range dst {
+		dst[i] = d.ring[((start+i)%ringFrames)*count+ch]
+	}
+}
@@ -0,0 +1,106 @@
+package player
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestITUDownmix(t *testing.T) {
+	tests := []struct {
+		name     string
+		channels []Channel
+	}{
+		{"mono", channelLayout(1, 0)},
+		{"stereo", channelLayout(2, 0)},
+		{"3.0", channelLayout(3, 0)},
+		{"quad", channelLayout(4, 0)},
+		{"5.1", channelLayout(6, 0)},
+		{"5.1 side", channelLayout(6, 0x60f)},
+		{"7.1", channelLayout(8, 0)},
+		{"2.1", []Channel{FrontLeft, FrontRight, LowFrequency}},
+	}
+	for _, test := range tests {
+		// Every side sums to 1, so a full scale signal on every channel can't clip
+		var sum [2]float64
+		for ch, gains := range ITUDownmix(test.channels) {
+			sum[0] += gains[0]
+			sum[1] += gains[1]
+			if test.channels[ch] == LowFrequency && gains != [2]float64{} {
+				t.Errorf("%s: LFE gains %v, want it dropped", test.name, gains)
+			}
+		}
+		if !approxEqual(sum[0], 1, 1e-9) || !approxEqual(sum[1], 1, 1e-9) {
+			t.Errorf("%s: columns sum to %v, want 1", test.name, sum)
+		}
+	}
+
+	// 5.1 with the center and surrounds at -3 dB of the fronts
+	const minus3dB = math.Sqrt2 / 2
+	scale := 1 + 2*minus3dB
+	want := Matrix{{1, 0}, {0, 1}, {minus3dB, minus3dB}, {0, 0}, {minus3dB, 0}, {0, minus3dB}}
+	m := ITUDownmix(channelLayout(6, 0))
+	for ch := range want {
+		if !approxEqual(m[ch][0], want[ch][0]/scale, 1e-9) || !approxEqual(m[ch][1], want[ch][1]/scale, 1e-9) {
+			t.Errorf("5.1 %v: gains %v, want %v", channelLayout(6, 0)[ch], m[ch], want[ch])
+		}
+	}
+}
+
+// failingReader fails every Read while fail is set
+type failingReader struct {
+	io.ReadSeeker
+	fail bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.fail {
+		return 0, errors.New("read failed")
+	}
+	return r.ReadSeeker.Read(p)
+}
+
+func TestDownmixSeek(t *testing.T) {
+	data := make([]byte, 64*2*2) // 64 stereo frames of 16 bits
+	for i := 0; i < len(data); i += 2 {
+		data[i+1] = 0x40 // 0.5
+	}
+	r := &failingReader{ReadSeeker: bytes.NewReader(data)}
+	decoder, err := newPCMDecoder(r, 0, 64, pcmLayout{channels: 2, width: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newDownmix(decoder)
+
+	samples := make([][2]float64, 16)
+	if n, ok := d.Stream(samples); n != 16 || !ok {
+		t.Fatalf("streamed %d frames, want 16", n)
+	}
+	latest := make([]float32, 4)
+	d.ReadChannel(0, latest)
+	if latest[3] != 0.5 {
+		t.Fatalf("latest frames %v, want 0.5", latest)
+	}
+
+	r.fail = true
+	if n, ok := d.Stream(samples); n != 0 || ok || d.Err() == nil {
+		t.Fatalf("streamed %d frames with err %v after a failed read, want an error", n, d.Err())
+	}
+	r.fail = false
+
+	if err := d.Seek(32); err != nil {
+		t.Fatal(err)
+	}
+	if d.Err() != nil {
+		t.Errorf("err %v after seeking, want it cleared", d.Err())
+	}
+	d.ReadChannel(0, latest)
+	if latest[0] != 0 || latest[3] != 0 {
+		t.Errorf("latest frames %v after seeking, want them cleared", latest)
+	}
+	if n, ok := d.Stream(samples); n != 16 || !ok || d.Position() != 48 {
+		t.Errorf("streamed %d frames to %d after seeking, want 16 to 48", n, d.Position())
+	}
+}
@@ -0,0 +1,75 @@
+package player
+
+import (
+	"log"
+	"time"
+)
+
+const eventBuffer = 64 // events a subscriber may fall behind before further events are dropped
+
+// Played audio between PositionChanged events
+const positionInterval = 50 * time.Millisecond
+
+// Event is sent to subscribers of a Player, one of the types below
+type Event interface {
+	isEvent()
+}
+
+// StateChanged is sent after every state transition
+type StateChanged struct {
+	From, To State
+}
+
+// PositionChanged is sent periodically while playing
+type PositionChanged struct {
+	Position, Duration time.Duration
+}
+
+// TrackLoaded is sent when a track was loaded or playback continued with the next track
+type TrackLoaded struct {
+	Track   Track
+	Gapless bool // continued from the previous track without stopping, see SetNext
+}
+
+// Error is sent when loading failed or a track stopped early because of a decoding error
+type Error struct {
+	Err error
+}
+
+func (StateChanged) isEvent()    {}
+func (PositionChanged) isEvent() {}
+func (TrackLoaded) isEvent()     {}
+func (Error) isEvent()           {}
+
+// Subscribe returns a channel receiving the player's events and a function to unsubscribe
+// NOTE: events are dropped while the channel is full, keep reading it
+func (p *Player) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, eventBuffer)
+	p.subMu.Lock()
+	p.subscribers = append(p.subscribers, ch)
+	p.subMu.Unlock()
+	return ch, func() {
+		p.subMu.Lock()
+		defer p.subMu.Unlock()
+		for i, sub := range p.subscribers {
+			if sub == ch {
+				p.subscribers = append(p.subscribers[:i], p.subscribers[i+1:]...)
+				close(ch)
+				return
+			}
+		}
+	}
+}
+
+// Send e to every subscriber without blocking, safe to call from any goroutine including the Output's
+func (p *Player) publish(e Event) {
+	p.subMu.Lock()
+	defer p.subMu.Unlock()
+	for _, ch := range p.subscribers {
+		select {
+		case ch <- e:
+		default:
+			log.Printf("player: dropped %T event for a slow subscriber", e)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package player
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// mp4Box is a box (atom) of an MP4 file read into memory
+type mp4Box struct {
+	typ  string
+	data []byte // payload after the size and type
+}
+
+// mp4Packet is a compressed packet (an MP4 "sample") of a track, it decodes to frames PCM frames
+type mp4Packet struct {
+	offset int64
+	size   int
+	start  int // first PCM frame
+	frames int
+}
+
+// mp4Track is an audio track with its sample description and packet table
+type mp4Track struct {
+	codec   string // type of the sample entry, e.g. "alac" or "mp4a" (AAC)
+	entry   []byte // sample entry payload
+	packets []mp4Packet
+	frames  int
+}
+
+// Find the moov box of an MP4 file without reading the media data, which is often most of the file
+// and return it with the size of the file
+func readMP4Moov(r io.ReadSeeker) ([]mp4Box, int64, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, err
+	}
+	for offset := int64(0); offset+8 <= end; {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, 0, err
+		}
+		var header [16]byte
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return nil, 0, fmt.Errorf("reading box header: %w", err)
+		}
+		headerSize, size := int64(8), int64(binary.BigEndian.Uint32(header[:4]))
+		switch size {
+		case 0: // extends to the end of the file
+			size = end - offset
+		case 1: // 64-bit size follows the type
+			if _, err := io.ReadFull(r, header[8:]); err != nil {
+				return nil, 0, fmt.Errorf("reading box header: %w", err)
+			}
+			headerSize, size = 16, int64(binary.BigEndian.Uint64(header[8:]))
+		}
+		if size < headerSize {
+			return nil, 0, fmt.Errorf("invalid %q box size %d", header[4:8], size)
+		}
+		if string(header[4:8]) == "moov" {
+			data := make([]byte, min(size, end-offset)-headerSize)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return nil, 0, fmt.Errorf("reading moov box: %w", err)
+			}
+			return parseMP4Boxes(data), end, nil
+		}
+		offset += size
+	}
+	return nil, 0, fmt.Errorf("no moov box")
+}
+
+// Split data into boxes, a truncated last box is dropped
+func parseMP4Boxes(data []byte) []mp4Box {
+	var boxes []mp4Box
+	for len(data) >= 8 {
+		headerSize, size := 8, uint64(binary.BigEndian.Uint32(data))
+		switch size {
+		case 0:
+			size = uint64(len(data))
+		case 1:
+			if len(data) < 16 {
+				return boxes
+			}
+			headerSize, size = 16, binary.BigEndian.Uint64(data[8:])
+		}
+		if size < uint64(headerSize) || size > uint64(len(data)) {
+			return boxes
+		}
+		boxes = append(boxes, mp4Box{typ: string(data[4:8]), data: data[headerSize:size]})
+		data = data[size:]
+	}
+	return boxes
+}
+
+// Return the payload of the box at path below boxes, e.g. "mdia", "minf", "stbl", nil if there is none
+func findMP4Box(boxes []mp4Box, path ...string) []byte {
+	for i, typ := range path {
+		var found *mp4Box
+		for j := range boxes {
+			if boxes[j].typ == typ {
+				found = &boxes[j]
+				break
+			}
+		}
+		if found == nil {
+			return nil
+		}
+		if i == len(path)-1 {
+			return found.data
+		}
+		boxes = parseMP4Boxes(found.data)
+	}
+	return nil
+}
+
+// Return the first sound track of the moov box of a file of fileSize bytes
+func findMP4AudioTrack(moov []mp4Box, fileSize int64) (*mp4Track, error) {
+	for _, trak := range moov {
+		if trak.typ != "trak" {
+			continue
+		}
+		boxes := parseMP4Boxes(trak.data)
+		if hdlr := findMP4Box(boxes, "mdia", "hdlr"); len(hdlr) < 12 || string(hdlr[8:12]) != "soun" {
+			continue
+		}
+		stbl := parseMP4Boxes(findMP4Box(boxes, "mdia", "minf", "stbl"))
+		return readMP4SampleTable(stbl, fileSize)
+	}
+	return nil, fmt.Errorf("no audio track")
+}
+
+// Build the packet table of a track from the boxes of its stbl box
+func readMP4SampleTable(stbl []mp4Box, fileSize int64) (*mp4Track, error) {
+	track := &mp4Track{}
+	stsd := findMP4Box(stbl, "stsd")
+	if len(stsd) < 8 || binary.BigEndian.Uint32(stsd[4:]) == 0 {
+		return nil, fmt.Errorf("missing sample description")
+	}
+	entries := parseMP4Boxes(stsd[8:])
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("invalid sample description")
+	}
+	track.codec, track.entry = entries[0].typ, entries[0].data
+
+	// Packet sizes
+	stsz := findMP4Box(stbl, "stsz")
+	if len(stsz) < 12 {
+		return nil, fmt.Errorf("missing sample size table")
+	}
+	fixedSize, count := binary.BigEndian.Uint32(stsz[4:]), int(binary.BigEndian.Uint32(stsz[8:]))
+	if fixedSize == 0 && len(stsz) < 12+4*count {
+		return nil, fmt.Errorf("sample size table too short")
+	}
+	if fixedSize != 0 && int64(count) > fileSize/int64(fixedSize) { // the packets must fit in the file
+		return nil, fmt.Errorf("%d packets of %d bytes in a file of %d bytes", count, fixedSize, fileSize)
+	}
+	track.packets = make([]mp4Packet, count)
+	for i := range track.packets {
+		track.packets[i].size = int(fixedSize)
+		if fixedSize == 0 {
+			track.packets[i].size = int(binary.BigEndian.Uint32(stsz[12+4*i:]))
+		}
+	}
+
+	// Packet durations, as runs of packets with the same duration
+	stts := findMP4Box(stbl, "stts")
+	if len(stts) < 8 {
+		return nil, fmt.Errorf("missing time-to-sample table")
+	}
+	packet := 0
+	for i := range int(binary.BigEndian.Uint32(stts[4:])) {
+		if len(stts) < 16+8*i {
+			return nil, fmt.Errorf("time-to-sample table too short")
+		}
+		run, duration := int(binary.BigEndian.Uint32(stts[8+8*i:])), int(binary.BigEndian.Uint32(stts[12+8*i:]))
+		for range run {
+			if packet == len(track.packets) {
+				break
+			}
+			track.packets[packet].start = track.frames
+			track.packets[packet].frames = duration
+			track.frames += duration
+			packet++
+		}
+	}
+	if packet != len(track.packets) {
+		return nil, fmt.Errorf("time-to-sample table covers %d of %d packets", packet, len(track.packets))
+	}
+
+	// Packet offsets, packets are stored in chunks of consecutive packets
+	var chunkOffsets []int64
+	if stco := findMP4Box(stbl, "stco"); len(stco) >= 8 {
+		for i := range int(binary.BigEndian.Uint32(stco[4:])) {
+			if len(stco) < 12+4*i {
+				return nil, fmt.Errorf("chunk offset table too short")
+			}
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint32(stco[8+4*i:])))
+		}
+	} else if co64 := findMP4Box(stbl, "co64"); len(co64) >= 8 {
+		for i := range int(binary.BigEndian.Uint32(co64[4:])) {
+			if len(co64) < 16+8*i {
+				return nil, fmt.Errorf("chunk offset table too short")
+			}
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint64(co64[8+8*i:])))
+		}
+	} else {
+		return nil, fmt.Errorf("missing chunk offset table")
+	}
+	stsc := findMP4Box(stbl, "stsc")
+	if len(stsc) < 8 {
+		return nil, fmt.Errorf("missing sample-to-chunk table")
+	}
+	runs := int(binary.BigEndian.Uint32(stsc[4:]))
+	if len(stsc) < 8+12*runs {
+		return nil, fmt.Errorf("sample-to-chunk table too short")
+	}
+	packet = 0
+	for i := range runs {
+		firstChunk := int(binary.BigEndian.Uint32(stsc[8+12*i:])) - 1 // 1-based
+		perChunk := int(binary.BigEndian.Uint32(stsc[12+12*i:]))
+		lastChunk := len(chunkOffsets) // the last run lasts until the last chunk
+		if i+1 < runs {
+			lastChunk = min(lastChunk, int(binary.BigEndian.Uint32(stsc[8+12*(i+1):]))-1)
+		}
+		for chunk := max(firstChunk, 0); chunk < lastChunk; chunk++ {
+			offset := chunkOffsets[chunk]
+			for range perChunk {
+				if packet == len(track.packets) {
+					break
+				}
+				track.packets[packet].offset = offset
+				offset += int64(track.packets[packet].size)
+				packet++
+			}
+		}
+	}
+	if packet != len(track.packets) {
+		return nil, fmt.Errorf("sample-to-chunk table covers %d of %d packets", packet, len(track.packets))
+	}
+	return track, nil
+}
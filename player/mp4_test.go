@@ -0,0 +1,86 @@
+package player
+
+import (
+	"encoding/binary"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Return a full box payload: version and flags of 0 and then values
+func mp4TestFullBox(values ...uint32) []byte {
+	b := make([]byte, 4)
+	for _, v := range values {
+		b = binary.BigEndian.AppendUint32(b, v)
+	}
+	return b
+}
+
+func mp4TestBox(typ string, payload []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(b, typ...), payload...)
+}
+
+func TestReadMP4SampleTable(t *testing.T) {
+	co64 := binary.BigEndian.AppendUint64(mp4TestFullBox(2), 100)
+	co64 = binary.BigEndian.AppendUint64(co64, 1<<32)
+	valid := map[string][]byte{
+		"stsd": append(mp4TestFullBox(1), mp4TestBox("alac", make([]byte, 4))...),
+		"stsz": mp4TestFullBox(0, 3, 10, 20, 30),
+		"stts": mp4TestFullBox(1, 3, 4096),
+		"stco": mp4TestFullBox(2, 100, 200),
+		"stsc": mp4TestFullBox(2, 1, 2, 1, 2, 1, 1), // 2 packets in the first chunk and 1 in the second
+	}
+	packets := []mp4Packet{{100, 10, 0, 4096}, {110, 20, 4096, 4096}, {200, 30, 8192, 4096}}
+
+	tests := []struct {
+		name    string
+		boxes   map[string][]byte // replacing those of valid, nil removes one
+		want    []mp4Packet
+		wantErr string
+	}{
+		{"stco", nil, packets, ""},
+		{"co64", map[string][]byte{"stco": nil, "co64": co64}, []mp4Packet{packets[0], packets[1], {1 << 32, 30, 8192, 4096}}, ""},
+		{"fixed size", map[string][]byte{"stsz": mp4TestFullBox(16, 3)}, []mp4Packet{{100, 16, 0, 4096}, {116, 16, 4096, 4096}, {200, 16, 8192, 4096}}, ""},
+		{"missing stsd", map[string][]byte{"stsd": nil}, nil, "missing sample description"},
+		{"missing stsz", map[string][]byte{"stsz": nil}, nil, "missing sample size table"},
+		{"truncated stsz", map[string][]byte{"stsz": mp4TestFullBox(0, 3, 10, 20)}, nil, "sample size table too short"},
+		{"stsz count overflow", map[string][]byte{"stsz": mp4TestFullBox(0, 0xffffffff, 10)}, nil, "sample size table too short"},
+		{"fixed size overflow", map[string][]byte{"stsz": mp4TestFullBox(0xffffffff, 0xffffffff)}, nil, "packets of 4294967295 bytes"},
+		{"truncated stts", map[string][]byte{"stts": mp4TestFullBox(2, 2, 4096)}, nil, "time-to-sample table too short"},
+		{"stts covers too few", map[string][]byte{"stts": mp4TestFullBox(1, 2, 4096)}, nil, "covers 2 of 3 packets"},
+		{"truncated stco", map[string][]byte{"stco": mp4TestFullBox(3, 100, 200)}, nil, "chunk offset table too short"},
+		{"truncated co64", map[string][]byte{"stco": nil, "co64": co64[:20]}, nil, "chunk offset table too short"},
+		{"missing chunk offsets", map[string][]byte{"stco": nil}, nil, "missing chunk offset table"},
+		{"truncated stsc", map[string][]byte{"stsc": mp4TestFullBox(2, 1, 2, 1, 2, 1)}, nil, "sample-to-chunk table too short"},
+		{"stsc count overflow", map[string][]byte{"stsc": mp4TestFullBox(0xffffffff, 1, 2, 1)}, nil, "sample-to-chunk table too short"},
+		{"stsc covers too few", map[string][]byte{"stsc": mp4TestFullBox(1, 1, 1, 1)}, nil, "covers 2 of 3 packets"},
+		{"stsc past the last chunk", map[string][]byte{"stsc": mp4TestFullBox(1, 3, 3, 1)}, nil, "covers 0 of 3 packets"},
+	}
+	for _, test := range tests {
+		var stbl []byte
+		for _, typ := range []string{"stsd", "stsz", "stts", "stco", "co64", "stsc"} {
+			payload, ok := test.boxes[typ]
+			if !ok {
+				payload = valid[typ]
+			}
+			if payload != nil {
+				stbl = append(stbl, mp4TestBox(typ, payload)...)
+			}
+		}
+		track, err := readMP4SampleTable(parseMP4Boxes(stbl), 1<<33)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: err = %v, want %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if track.codec != "alac" || track.frames != 3*4096 || !slices.Equal(track.packets, test.want) {
+			t.Errorf("%s: %q track of %d frames with packets %v, want %v", test.name, track.codec, track.frames, track.packets, test.want)
+		}
+	}
+}
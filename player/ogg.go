@@ -0,0 +1,207 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const oggHeaderSize = 27
+
+// Header type flags of an Ogg page
+const (
+	oggContinued = 0x01 // the first packet continues from the previous page
+	oggFirst     = 0x02 // beginning of a stream
+	oggLast      = 0x04 // end of a stream
+)
+
+// oggPage is a page of an Ogg bitstream (RFC 3533)
+type oggPage struct {
+	offset  int64 // of the page in the file
+	size    int   // of the whole page including its header
+	flags   byte
+	granule int64 // codec-defined position at the end of the last packet finished on the page, -1 if none is
+	serial  uint32
+	lacing  []byte // segment table, a value below 255 ends a packet
+	body    []byte
+}
+
+var errNotOggPage = errors.New("not an Ogg page")
+
+// Read the page at offset of r and check its CRC
+func readOggPage(r io.ReadSeeker, offset int64) (oggPage, error) {
+	page := oggPage{offset: offset}
+	if _, err := r.Seek(offset, io.SeekStart); err != nil {
+		return page, err
+	}
+	var header [oggHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return page, err
+	}
+	if string(header[:4]) != "OggS" || header[4] != 0 {
+		return page, errNotOggPage
+	}
+	page.flags = header[5]
+	page.granule = int64(binary.LittleEndian.Uint64(header[6:]))
+	page.serial = binary.LittleEndian.Uint32(header[14:])
+	page.lacing = make([]byte, header[26])
+	if _, err := io.ReadFull(r, page.lacing); err != nil {
+		return page, err
+	}
+	bodySize := 0
+	for _, v := range page.lacing {
+		bodySize += int(v)
+	}
+	page.body = make([]byte, bodySize)
+	if _, err := io.ReadFull(r, page.body); err != nil {
+		return page, err
+	}
+	page.size = oggHeaderSize + len(page.lacing) + bodySize
+
+	crc := binary.LittleEndian.Uint32(header[22:])
+	clear(header[22:26]) // the checksum is computed with its own field zeroed
+	if oggCRC(oggCRC(oggCRC(0, header[:]), page.lacing), page.body) != crc {
+		return page, errNotOggPage
+	}
+	return page, nil
+}
+
+// Return the first page of serial starting within [from, to) of r, searching for its capture pattern
+func findOggPage(r io.ReadSeeker, serial uint32, from, to int64) (oggPage, error) {
+	buf := make([]byte, 64*1024)
+	for from < to {
+		if _, err := r.Seek(from, io.SeekStart); err != nil {
+			return oggPage{}, err
+		}
+		want := int(min(int64(len(buf)), to-from+3)) // a page starting right before to still has its pattern read
+		n, err := io.ReadFull(r, buf[:want])
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			return oggPage{}, err
+		}
+		for i := 0; ; i++ {
+			k := bytes.Index(buf[i:n], []byte("OggS"))
+			if k < 0 || from+int64(i+k) >= to {
+				break
+			}
+			i += k
+			page, err := readOggPage(r, from+int64(i))
+			if err == nil && page.serial == serial {
+				return page, nil
+			}
+		}
+		if n < want { // end of the file
+			break
+		}
+		from += int64(n - 3) // the pattern may straddle the buffers
+	}
+	return oggPage{}, io.EOF
+}
+
+// Return the packets finished on the page, without the end of a packet continued from the previous page
+func (p *oggPage) packets() [][]byte {
+	var packets [][]byte
+	pos, start := 0, 0
+	skip := p.flags&oggContinued != 0
+	for _, v := range p.lacing {
+		pos += int(v)
+		if v < 255 {
+			if !skip {
+				packets = append(packets, p.body[start:pos])
+			}
+			start, skip = pos, false
+		}
+	}
+	return packets
+}
+
+// oggPacketReader reads the packets of one logical bitstream of an Ogg file
+type oggPacketReader struct {
+	r        io.ReadSeeker
+	serial   uint32
+	next     int64    // offset of the next page
+	packets  [][]byte // finished packets of the last page which weren't read yet
+	partial  []byte   // start of a packet continuing on the next page
+	inPacket bool     // partial holds the start of a packet, which may be empty
+	ended    bool     // read the page marked as the end of the stream
+}
+
+// Continue reading with the page at offset, dropping the end of any packet continued from its previous page
+func (o *oggPacketReader) seek(offset int64) {
+	o.next, o.packets, o.partial, o.inPacket, o.ended = offset, nil, nil, false, false
+}
+
+// Continue reading after page, dropping the packets finished on it so the next one starts at its granule position
+func (o *oggPacketReader) seekAfter(page oggPage) {
+	o.seek(page.offset + int64(page.size))
+	o.addPage(page)
+	o.packets = nil
+}
+
+// Split the page into packets, joining the ones that continue across pages
+func (o *oggPacketReader) addPage(page oggPage) {
+	o.ended = page.flags&oggLast != 0
+	if page.flags&oggContinued == 0 { // the rest of a continued packet was lost
+		o.partial, o.inPacket = nil, false
+	}
+	skip := page.flags&oggContinued != 0 && !o.inPacket // the start of the first packet wasn't read
+	pos := 0
+	for _, v := range page.lacing {
+		if !skip {
+			o.partial, o.inPacket = append(o.partial, page.body[pos:pos+int(v)]...), true
+		}
+		pos += int(v)
+		if v < 255 { // the packet ends here
+			if !skip {
+				o.packets = append(o.packets, o.partial)
+			}
+			o.partial, o.inPacket, skip = nil, false, false
+		}
+	}
+}
+
+// Return the next packet, io.EOF at the end of the stream
+func (o *oggPacketReader) nextPacket() ([]byte, error) {
+	for len(o.packets) == 0 {
+		if o.ended {
+			return nil, io.EOF
+		}
+		page, err := readOggPage(o.r, o.next)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, io.EOF // a truncated last page ends the stream
+		} else if err != nil {
+			return nil, fmt.Errorf("ogg page at %d: %w", o.next, err)
+		}
+		o.next += int64(page.size)
+		if page.serial == o.serial { // skip e.g. a multiplexed video stream
+			o.addPage(page)
+		}
+	}
+	packet := o.packets[0]
+	o.packets = o.packets[1:]
+	return packet, nil
+}
+
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+// Update the Ogg CRC-32 (unreflected, polynomial 0x04c11db7) with data
+func oggCRC(crc uint32, data []byte) uint32 {
+	for _, b := range data {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
@@ -0,0 +1,143 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+// First page of a mono Ogg Opus file written by libogg, it holds the OpusHead
+var oggOpusHeadPage, _ = hex.DecodeString("4f676753000200000000000000007962efee00000000d7165d6c01134f707573486561640101380180bb0000000000")
+
+// Return an Ogg page of the given packet data, with its checksum
+func oggTestPage(serial uint32, flags byte, granule int64, lacing, body []byte) []byte {
+	page := make([]byte, oggHeaderSize, oggHeaderSize+len(lacing)+len(body))
+	copy(page, "OggS")
+	page[5] = flags
+	binary.LittleEndian.PutUint64(page[6:], uint64(granule))
+	binary.LittleEndian.PutUint32(page[14:], serial)
+	page[26] = byte(len(lacing))
+	page = append(append(page, lacing...), body...)
+	binary.LittleEndian.PutUint32(page[22:], oggCRC(0, page))
+	return page
+}
+
+// Return the lacing values of a packet of n bytes which ends on the page
+func oggLacing(n int) []byte {
+	lacing := bytes.Repeat([]byte{255}, n/255)
+	return append(lacing, byte(n%255))
+}
+
+func TestReadOggPage(t *testing.T) {
+	page, err := readOggPage(bytes.NewReader(oggOpusHeadPage), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.flags != oggFirst || page.granule != 0 || page.serial != 0xeeef6279 || page.size != len(oggOpusHeadPage) {
+		t.Errorf("got flags %#x, granule %d, serial %#x and size %d", page.flags, page.granule, page.serial, page.size)
+	}
+	if packets := page.packets(); len(packets) != 1 || !bytes.HasPrefix(packets[0], []byte("OpusHead")) || len(packets[0]) != 19 {
+		t.Errorf("packets = %q, want the OpusHead", packets)
+	}
+
+	// The stored checksum is the CRC of the page with the checksum field zeroed
+	zeroed := bytes.Clone(oggOpusHeadPage)
+	clear(zeroed[22:26])
+	if crc := oggCRC(0, zeroed); crc != binary.LittleEndian.Uint32(oggOpusHeadPage[22:]) {
+		t.Errorf("oggCRC = %#08x, want %#08x", crc, binary.LittleEndian.Uint32(oggOpusHeadPage[22:]))
+	}
+
+	corrupt := bytes.Clone(oggOpusHeadPage)
+	corrupt[len(corrupt)-1] ^= 1
+	if _, err := readOggPage(bytes.NewReader(corrupt), 0); !errors.Is(err, errNotOggPage) {
+		t.Errorf("corrupt page: err = %v, want %v", err, errNotOggPage)
+	}
+	if _, err := readOggPage(bytes.NewReader(oggOpusHeadPage[:40]), 0); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated page: err = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestFindOggPage(t *testing.T) {
+	other := oggTestPage(2, 0, 0, []byte{3}, []byte("abc"))
+	want := oggTestPage(1, 0, 10, []byte{3}, []byte("def"))
+	file := append(append([]byte("garbage OggS"), other...), want...)
+	page, err := findOggPage(bytes.NewReader(file), 1, 1, int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.offset != int64(12+len(other)) || string(page.body) != "def" {
+		t.Errorf("found the page at %d with %q", page.offset, page.body)
+	}
+	if _, err := findOggPage(bytes.NewReader(file), 1, page.offset+1, int64(len(file))); !errors.Is(err, io.EOF) {
+		t.Errorf("past the last page: err = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestOggPacketReader(t *testing.T) {
+	a := bytes.Repeat([]byte{'a'}, 10)
+	b := bytes.Repeat([]byte{'b'}, 600) // continues over two more pages
+	c := bytes.Repeat([]byte{'c'}, 5)
+	d := bytes.Repeat([]byte{'d'}, 300) // its end is lost
+	e := bytes.Repeat([]byte{'e'}, 7)
+
+	var file []byte
+	var pages []oggPage
+	add := func(serial uint32, flags byte, granule int64, lacing, body []byte) {
+		data := oggTestPage(serial, flags, granule, lacing, body)
+		page, err := readOggPage(bytes.NewReader(data), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page.offset = int64(len(file))
+		pages = append(pages, page)
+		file = append(file, data...)
+	}
+	add(1, oggFirst, 100, append(oggLacing(len(a)), 255), append(a, b[:255]...))
+	add(9, oggFirst, 0, []byte{2}, []byte("xx")) // another stream
+	add(1, oggContinued, -1, []byte{255}, b[255:510])
+	add(1, oggContinued, 200, append(oggLacing(len(b)-510), oggLacing(len(c))...), append(b[510:], c...))
+	add(1, 0, -1, []byte{255}, d[:255])
+	add(1, oggLast, 300, oggLacing(len(e)), e) // not continued, the rest of d is lost
+
+	read := func(o *oggPacketReader) []string {
+		var packets []string
+		for {
+			packet, err := o.nextPacket()
+			if errors.Is(err, io.EOF) {
+				return packets
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			packets = append(packets, string(packet))
+		}
+	}
+	tests := []struct {
+		name     string
+		position func(o *oggPacketReader)
+		want     []string
+	}{
+		{"from the start", func(o *oggPacketReader) { o.seek(0) }, []string{string(a), string(b), string(c), string(e)}},
+		{"after the first page", func(o *oggPacketReader) { o.seekAfter(pages[0]) }, []string{string(b), string(c), string(e)}},
+		{"within a continued packet", func(o *oggPacketReader) { o.seek(pages[2].offset) }, []string{string(c), string(e)}},
+		{"after a page without a finished packet", func(o *oggPacketReader) { o.seekAfter(pages[2]) }, []string{string(c), string(e)}},
+	}
+	for _, test := range tests {
+		o := &oggPacketReader{r: bytes.NewReader(file), serial: 1}
+		test.position(o)
+		if got := read(o); !slices.Equal(got, test.want) {
+			t.Errorf("%s: read %d packets of %v bytes, want %v", test.name, len(got), lengths(got), lengths(test.want))
+		}
+	}
+}
+
+func lengths(packets []string) []int {
+	var n []int
+	for _, p := range packets {
+		n = append(n, len(p))
+	}
+	return n
+}
@@ -0,0 +1,302 @@
+package player
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/pion/opus"
+)
+
+const opusSampleRate = 48000 // Ogg Opus is always decoded at 48 kHz (RFC 7845)
+const opusPreRoll = 3840     // samples decoded before a seek target until the decoder converged (80 ms)
+const opusMaxFrames = 5760   // samples per channel of the longest packet (120 ms)
+
+// opusHead is the identification header of an Ogg Opus stream
+type opusHead struct {
+	channels int
+	preSkip  int     // samples to discard at the start of the stream
+	gain     float64 // linear output gain to apply
+}
+
+// Parse the OpusHead packet, only streams of a single mono or stereo Opus stream are supported
+func parseOpusHead(packet []byte) (opusHead, error) {
+	var head opusHead
+	if len(packet) < 19 || string(packet[:8]) != "OpusHead" {
+		return head, fmt.Errorf("missing OpusHead")
+	}
+	if packet[8]>>4 != 0 { // minor versions are compatible
+		return head, fmt.Errorf("unsupported version %d", packet[8])
+	}
+	head.channels = int(packet[9])
+	head.preSkip = int(binary.LittleEndian.Uint16(packet[10:]))
+	head.gain = math.Pow(10, float64(int16(binary.LittleEndian.Uint16(packet[16:])))/(20*256)) // Q7.8 dB
+	if head.channels < 1 || head.channels > 2 {
+		return head, fmt.Errorf("%d channels aren't supported, only mono and stereo", head.channels)
+	}
+	if family := packet[18]; family != 0 { // a mapping table of a single stream in channel order is like family 0
+		single := len(packet) >= 21+head.channels && packet[19] == 1 && int(packet[20]) == head.channels-1
+		for i := 0; single && i < head.channels; i++ {
+			single = int(packet[21+i]) == i
+		}
+		if !single {
+			return head, fmt.Errorf("multistream channel mapping family %d isn't supported", family)
+		}
+	}
+	return head, nil
+}
+
+// Return the number of samples at 48 kHz a packet decodes to, from its TOC byte (RFC 6716 section 3.1)
+func opusPacketSamples(packet []byte) int {
+	if len(packet) == 0 {
+		return 0
+	}
+	config := int(packet[0] >> 3)
+	var frameSize int
+	switch {
+	case config < 12: // SILK-only, 10, 20, 40 or 60 ms
+		frameSize = []int{480, 960, 1920, 2880}[config%4]
+	case config < 16: // hybrid, 10 or 20 ms
+		frameSize = []int{480, 960}[config%2]
+	default: // CELT-only, 2.5, 5, 10 or 20 ms
+		frameSize = []int{120, 240, 480, 960}[config%4]
+	}
+	switch packet[0] & 3 {
+	case 0:
+		return frameSize
+	case 1, 2:
+		return 2 * frameSize
+	}
+	if len(packet) < 2 {
+		return 0
+	}
+	return int(packet[1]&0x3f) * frameSize
+}
+
+// opusDecoder streams an Ogg Opus file, seeking with the granule positions of its pages
+// NOTE: the granule position of a page counts the samples at 48 kHz up to the end of its last finished packet,
+// including the pre-skip
+type opusDecoder struct {
+	r         io.ReadSeeker
+	head      opusHead
+	serial    uint32
+	dataStart int64 // offset of the first audio page after the headers
+	end       int64 // size of the file
+	start     int64 // granule position at the start of the first audio packet, usually 0
+	frames    int
+	decoder   opus.Decoder
+	packets   oggPacketReader
+	pos       int
+	skip      int // decoded samples to drop before pos, for the pre-skip and the pre-roll of seeks
+	err       error
+
+	decoded    []float32 // interleaved samples of the last decoded packet
+	decodedLen int
+	read       int // samples of decoded that were streamed or skipped
+}
+
+// Decode an Ogg Opus file (RFC 7845) at 48 kHz
+func decodeOpus(r io.ReadSeeker) (beep.StreamSeekCloser, beep.Format, error) {
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("opus: %w", err)
+	}
+	first, err := readOggPage(r, 0)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("opus: %w", err)
+	}
+	headers := first.packets()
+	if first.flags&oggFirst == 0 || len(headers) != 1 {
+		return nil, beep.Format{}, fmt.Errorf("opus: the first page doesn't hold only the OpusHead")
+	}
+	head, err := parseOpusHead(headers[0])
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("opus: %w", err)
+	}
+	d := &opusDecoder{r: r, head: head, serial: first.serial, end: end}
+	d.packets = oggPacketReader{r: r, serial: first.serial, next: int64(first.size)}
+	tags, err := d.packets.nextPacket()
+	if err != nil || len(tags) < 8 || string(tags[:8]) != "OpusTags" {
+		return nil, beep.Format{}, fmt.Errorf("opus: missing OpusTags")
+	}
+	d.dataStart = d.packets.next // the audio starts on a new page
+
+	if err := d.readLength(); err != nil {
+		return nil, beep.Format{}, fmt.Errorf("opus: %w", err)
+	}
+	if d.decoder, err = opus.NewDecoderWithOutput(opusSampleRate, head.channels); err != nil {
+		return nil, beep.Format{}, fmt.Errorf("opus: %w", err)
+	}
+	d.decoded = make([]float32, opusMaxFrames*head.channels)
+	d.packets.seek(d.dataStart)
+	d.skip = head.preSkip
+	format := beep.Format{SampleRate: opusSampleRate, NumChannels: head.channels, Precision: 2}
+	return d, format, nil
+}
+
+// Return the page of the stream at offset, or the next one found after it before the end of the file
+func (d *opusDecoder) pageAt(offset int64) (oggPage, error) {
+	page, err := readOggPage(d.r, offset)
+	switch {
+	case err == nil && page.serial == d.serial:
+		return page, nil
+	case err == nil:
+		offset += int64(page.size)
+	default:
+		offset++
+	}
+	return findOggPage(d.r, d.serial, offset, d.end)
+}
+
+// Find the granule positions of the first and last sample to set start and frames
+func (d *opusDecoder) readLength() error {
+	first, err := d.pageAt(d.dataStart)
+	if errors.Is(err, io.EOF) { // no audio
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if first.granule != -1 { // the packets finished on the first page end at its granule position
+		d.start = first.granule
+		for _, packet := range first.packets() {
+			d.start -= int64(opusPacketSamples(packet))
+		}
+		d.start = max(d.start, 0)
+	}
+
+	// The last page with a granule position ends the stream, search backwards from the end for it
+	last := int64(-1)
+	for window := int64(64 * 1024); last == -1; window *= 2 {
+		from := max(d.end-window, d.dataStart)
+		for offset := from; ; {
+			page, err := d.pageAt(offset)
+			if errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				return err
+			}
+			if page.granule != -1 {
+				last = page.granule
+			}
+			offset = page.offset + int64(page.size)
+		}
+		if from == d.dataStart {
+			break
+		}
+	}
+	d.frames = max(int(last-d.start)-d.head.preSkip, 0)
+	return nil
+}
+
+// Return the last page of the stream whose granule position isn't past granule, found is false if there's none
+func (d *opusDecoder) pageBefore(granule int64) (page oggPage, found bool, err error) {
+	// Bisect to a page at most a few pages before it, lo is always at or before it
+	lo, hi := d.dataStart, d.end
+	for hi-lo > 64*1024 {
+		mid := lo + (hi-lo)/2
+		page, err := findOggPage(d.r, d.serial, mid, hi)
+		if errors.Is(err, io.EOF) {
+			hi = mid
+			continue
+		} else if err != nil {
+			return page, false, err
+		}
+		if page.granule == -1 || page.granule > granule {
+			hi = mid
+		} else {
+			lo = page.offset
+		}
+	}
+
+	for offset := lo; offset < d.end; {
+		next, err := d.pageAt(offset)
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return page, false, err
+		}
+		if next.granule != -1 {
+			if next.granule > granule {
+				break
+			}
+			page, found = next, true
+		}
+		offset = next.offset + int64(next.size)
+	}
+	return page, found, nil
+}
+
+func (d *opusDecoder) Stream(samples [][2]float64) (n int, ok bool) {
+	channels := d.head.channels
+	for n < len(samples) && d.pos < d.frames {
+		if d.read == d.decodedLen {
+			if d.err != nil {
+				break
+			}
+			if d.err = d.decodeNext(); d.err != nil {
+				break
+			}
+			continue
+		}
+		k := min(len(samples)-n, d.decodedLen-d.read, d.frames-d.pos)
+		for i := range k {
+			frame := d.decoded[(d.read+i)*channels:]
+			samples[n+i] = [2]float64{float64(frame[0]) * d.head.gain, float64(frame[channels-1]) * d.head.gain}
+		}
+		n += k
+		d.read += k
+		d.pos += k
+	}
+	return n, n > 0
+}
+
+// Decode the next packet into decoded, dropping the samples still to skip
+func (d *opusDecoder) decodeNext() error {
+	packet, err := d.packets.nextPacket()
+	if errors.Is(err, io.EOF) {
+		return fmt.Errorf("opus: stream ended %d samples early", d.frames-d.pos)
+	} else if err != nil {
+		return fmt.Errorf("opus: %w", err)
+	}
+	n, err := d.decoder.DecodeToFloat32(packet, d.decoded)
+	if err != nil {
+		return fmt.Errorf("opus: %w", err)
+	}
+	d.decodedLen = n
+	d.read = min(d.skip, n)
+	d.skip -= d.read
+	return nil
+}
+
+func (d *opusDecoder) Err() error    { return d.err }
+func (d *opusDecoder) Len() int      { return d.frames }
+func (d *opusDecoder) Position() int { return d.pos }
+func (d *opusDecoder) Close() error  { return nil } // the reader is owned by the caller of Decode
+
+// Seek to p by decoding from the last page at least opusPreRoll samples before it
+func (d *opusDecoder) Seek(p int) error {
+	if p < 0 || p > d.frames {
+		return fmt.Errorf("opus: seek position %v out of range [%v, %v]", p, 0, d.frames)
+	}
+	target := d.start + int64(d.head.preSkip) + int64(p) // granule position of the sample at p
+	page, found, err := d.pageBefore(max(target-opusPreRoll, d.start))
+	if err != nil {
+		return fmt.Errorf("opus: %w", err)
+	}
+	decodeFrom := d.start
+	if found {
+		d.packets.seekAfter(page)
+		decodeFrom = page.granule
+	} else {
+		d.packets.seek(d.dataStart)
+	}
+	if err := d.decoder.Init(opusSampleRate, d.head.channels); err != nil { // the state before the seek doesn't apply anymore
+		return fmt.Errorf("opus: %w", err)
+	}
+	d.skip = int(target - decodeFrom)
+	d.decodedLen, d.read, d.pos, d.err = 0, 0, p, nil
+	return nil
+}
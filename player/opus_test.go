@@ -0,0 +1,164 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// 20 ms SILK wideband mono packet from an Ogg Opus file written by libopus
+var opusTestPacket, _ = hex.DecodeString("4883cade8ae567d51caca254faffbf")
+
+// Return an OpusHead of the given channels, pre-skip, gain in Q7.8 dB and mapping family and table
+func opusTestHead(channels byte, preSkip uint16, gain int16, family byte, mapping ...byte) []byte {
+	head := []byte("OpusHead\x01")
+	head = append(head, channels)
+	head = binary.LittleEndian.AppendUint16(head, preSkip)
+	head = binary.LittleEndian.AppendUint32(head, 48000)
+	head = binary.LittleEndian.AppendUint16(head, uint16(gain))
+	return append(append(head, family), mapping...)
+}
+
+func TestParseOpusHead(t *testing.T) {
+	tests := []struct {
+		name    string
+		packet  []byte
+		want    opusHead
+		wantErr bool
+	}{
+		{"mono", opusTestHead(1, 312, 0, 0), opusHead{channels: 1, preSkip: 312, gain: 1}, false},
+		{"negative gain", opusTestHead(2, 3840, -6*256, 0), opusHead{channels: 2, preSkip: 3840, gain: 0.501187}, false},
+		{"positive gain", opusTestHead(2, 0, 3*256+128, 0), opusHead{channels: 2, gain: 1.496236}, false},
+		{"family 1 single stream", opusTestHead(2, 312, 0, 1, 1, 1, 0, 1), opusHead{channels: 2, preSkip: 312, gain: 1}, false},
+		{"family 1 swapped channels", opusTestHead(2, 312, 0, 1, 1, 1, 1, 0), opusHead{}, true},
+		{"family 1 two streams", opusTestHead(2, 312, 0, 1, 2, 0, 0, 1), opusHead{}, true},
+		{"family 1 without a mapping table", opusTestHead(2, 312, 0, 1), opusHead{}, true},
+		{"surround", opusTestHead(6, 312, 0, 1, 4, 2, 0, 4, 1, 2, 3, 5), opusHead{}, true},
+		{"no channels", opusTestHead(0, 312, 0, 0), opusHead{}, true},
+		{"major version 1", append([]byte("OpusHead\x10"), opusTestHead(1, 0, 0, 0)[9:]...), opusHead{}, true},
+		{"truncated", opusTestHead(1, 312, 0, 0)[:18], opusHead{}, true},
+	}
+	for _, test := range tests {
+		head, err := parseOpusHead(test.packet)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: err = %v, want an error: %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if head.channels != test.want.channels || head.preSkip != test.want.preSkip || !approxEqual(head.gain, test.want.gain, 1e-6) {
+			t.Errorf("%s: got %+v, want %+v", test.name, head, test.want)
+		}
+	}
+}
+
+func approxEqual(a, b, tolerance float64) bool {
+	return a-b <= tolerance && b-a <= tolerance
+}
+
+func TestOpusPacketSamples(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet []byte
+		want   int
+	}{
+		{"empty", nil, 0},
+		{"SILK 10 ms, code 0", []byte{0 << 3}, 480},
+		{"SILK 20 ms, code 0", []byte{1 << 3}, 960},
+		{"SILK 60 ms, code 1", []byte{3<<3 | 1}, 5760},
+		{"hybrid 10 ms, code 2", []byte{12<<3 | 2}, 960},
+		{"hybrid 20 ms, code 0", []byte{13 << 3}, 960},
+		{"CELT 2.5 ms, code 3 with 5 frames", []byte{16<<3 | 3, 5}, 600},
+		{"CELT 20 ms, code 3 with padding and 6 frames", []byte{19<<3 | 3, 0x40 | 6, 0}, 5760},
+		{"code 3 without a frame count", []byte{19<<3 | 3}, 0},
+		{"libopus packet", opusTestPacket, 960},
+	}
+	for _, test := range tests {
+		if got := opusPacketSamples(test.packet); got != test.want {
+			t.Errorf("%s: got %d, want %d", test.name, got, test.want)
+		}
+	}
+}
+
+// Return an Ogg Opus file with pages of packetsPerPage copies of opusTestPacket, pre-skip 312
+func opusTestFile(pages, packetsPerPage int) []byte {
+	const serial = 7
+	head := opusTestHead(1, 312, 0, 0)
+	tags := []byte("OpusTags\x00\x00\x00\x00\x00\x00\x00\x00")
+	file := oggTestPage(serial, oggFirst, 0, oggLacing(len(head)), head)
+	file = append(file, oggTestPage(serial, 0, 0, oggLacing(len(tags)), tags)...)
+	granule := int64(0)
+	for page := range pages {
+		var lacing, body []byte
+		for range packetsPerPage {
+			lacing = append(lacing, oggLacing(len(opusTestPacket))...)
+			body = append(body, opusTestPacket...)
+			granule += 960
+		}
+		flags := byte(0)
+		if page == pages-1 {
+			flags = oggLast
+		}
+		file = append(file, oggTestPage(serial, flags, granule, lacing, body)...)
+	}
+	return file
+}
+
+func TestOpusDecoderSeek(t *testing.T) {
+	file := opusTestFile(10, 20) // pages end at granule positions 19200, 38400...
+	s, format, err := decodeOpus(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := s.(*opusDecoder)
+	if format.SampleRate != opusSampleRate || format.NumChannels != 1 {
+		t.Errorf("format = %+v", format)
+	}
+	if want := 10*20*960 - 312; d.Len() != want {
+		t.Fatalf("Len = %d, want %d", d.Len(), want)
+	}
+	full := make([][2]float64, d.Len())
+	if n, _ := d.Stream(full); n != d.Len() || d.Err() != nil {
+		t.Fatalf("streamed %d of %d samples: %v", n, d.Len(), d.Err())
+	}
+
+	tests := []struct {
+		pos        int
+		decodeFrom int64 // granule position decoding starts at, 0 is the start of the stream
+	}{
+		{0, 0},
+		{1000, 0},
+		{19200 - 312 + opusPreRoll, 19200}, // the pre-roll starts right at the end of the first page
+		{19200 - 312 + opusPreRoll - 1, 0},
+		{50000, 38400},
+		{d.Len() - 1, 172800},
+		{d.Len(), 172800},
+	}
+	for _, test := range tests {
+		if err := d.Seek(test.pos); err != nil {
+			t.Fatal(err)
+		}
+		target := int64(test.pos) + 312 // granule position of the sample at pos
+		if d.Position() != test.pos || int64(d.skip) != target-test.decodeFrom {
+			t.Errorf("Seek(%d): position %d and skip %d, want skip %d", test.pos, d.Position(), d.skip, target-test.decodeFrom)
+			continue
+		}
+		rest := make([][2]float64, d.Len())
+		n, _ := d.Stream(rest)
+		if n != d.Len()-test.pos || d.Err() != nil {
+			t.Errorf("Seek(%d): streamed %d samples, want %d: %v", test.pos, n, d.Len()-test.pos, d.Err())
+			continue
+		}
+		for i := range min(n, 2000) {
+			if !approxEqual(rest[i][0], full[test.pos+i][0], 1e-4) {
+				t.Errorf("Seek(%d): sample %d is %v, want %v", test.pos, test.pos+i, rest[i][0], full[test.pos+i][0])
+				break
+			}
+		}
+	}
+	if err := d.Seek(d.Len() + 1); err == nil {
+		t.Error("Seek past the end didn't fail")
+	}
+}
@@ -0,0 +1,12 @@
+package player
+
+import "github.com/gopxl/beep/v2"
+
+// Output plays the audio of a Player at SampleRate, e.g. the speaker (see package speakerout)
+// NOTE: Lock must stop the output from streaming until Unlock, the Player changes tracks while holding it
+type Output interface {
+	Play(s beep.Streamer)
+	Clear() // stop and remove every playing streamer
+	Lock()
+	Unlock()
+}
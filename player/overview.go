@@ -0,0 +1,164 @@
+package player
+
+import (
+	"sync"
+
+	"github.com/gopxl/beep/v2"
+)
+
+const overviewBinSize = 256   // samples summarized by each peak of the finest level
+const overviewLevelFactor = 4 // each following level is this much coarser
+const overviewLevels = 6
+
+// Peak is the min/max sample value (-1.0 to 1.0) of a range of samples, Min > Max if it has none
+type Peak struct {
+	Min, Max float32
+}
+
+func (p Peak) merge(o Peak) Peak {
+	return Peak{Min: min(p.Min, o.Min), Max: max(p.Max, o.Max)}
+}
+
+var emptyPeak = Peak{Min: 1, Max: -1}
+
+// Overview is a min/max summary of a whole track at several zoom levels, e.g. to draw it as a seek bar
+// NOTE: Columns may be called from any goroutine while it's filled by Process
+type Overview struct {
+	mu           sync.RWMutex
+	levels       [][]Peak // levels[0] uses overviewBinSize samples per peak
+	pending      []Peak   // partially filled peak of each level
+	pendingCount []int
+	current      Peak // peak of the level 0 bin being filled
+	count        int
+	totalSamples int
+	done         bool
+}
+
+// NewOverview returns an empty Overview of a track of totalSamples samples
+func NewOverview(totalSamples int) *Overview {
+	o := &Overview{
+		levels:       make([][]Peak, overviewLevels),
+		pending:      make([]Peak, overviewLevels),
+		pendingCount: make([]int, overviewLevels),
+		current:      emptyPeak,
+		totalSamples: totalSamples,
+	}
+	for i := range o.pending {
+		o.pending[i] = emptyPeak
+	}
+	return o
+}
+
+// Return the number of samples summarized by each peak at level
+func binSize(level int) int {
+	size := overviewBinSize
+	for range level {
+		size *= overviewLevelFactor
+	}
+	return size
+}
+
+// Add a finished peak to level and cascade it into the coarser levels
+func (o *Overview) pushLocked(level int, p Peak) {
+	o.levels[level] = append(o.levels[level], p)
+	if level+1 >= overviewLevels {
+		return
+	}
+	next := level + 1
+	o.pending[next] = o.pending[next].merge(p)
+	o.pendingCount[next]++
+	if o.pendingCount[next] == overviewLevelFactor {
+		o.pushLocked(next, o.pending[next])
+		o.pending[next] = emptyPeak
+		o.pendingCount[next] = 0
+	}
+}
+
+// Process summarizes the next decoded samples of the track
+func (o *Overview) Process(samples [][2]float64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, sample := range samples {
+		o.current.Min = min(o.current.Min, float32(sample[0]), float32(sample[1]))
+		o.current.Max = max(o.current.Max, float32(sample[0]), float32(sample[1]))
+		o.count++
+		if o.count == overviewBinSize {
+			o.pushLocked(0, o.current)
+			o.current = emptyPeak
+			o.count = 0
+		}
+	}
+}
+
+// Finish flushes the partially filled peaks at the end of the track
+func (o *Overview) Finish() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.count > 0 {
+		o.pushLocked(0, o.current)
+		o.count = 0
+	}
+	for level := range overviewLevels {
+		if o.pendingCount[level] > 0 {
+			o.levels[level] = append(o.levels[level], o.pending[level])
+			o.pending[level] = emptyPeak
+			o.pendingCount[level] = 0
+		}
+	}
+	o.done = true
+}
+
+// Columns returns one Peak per column for drawing the overview width pixels wide
+// NOTE: columns past the processed part of the track are empty (Min > Max)
+func (o *Overview) Columns(width int) []Peak {
+	if o == nil || width <= 0 || o.totalSamples <= 0 {
+		return nil
+	}
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	// Use the coarsest level that still has at least one peak per column
+	samplesPerColumn := float64(o.totalSamples) / float64(width)
+	level := 0
+	for level+1 < overviewLevels && float64(binSize(level+1)) <= samplesPerColumn {
+		level++
+	}
+	peaks := o.levels[level]
+	size := float64(binSize(level))
+
+	cols := make([]Peak, width)
+	for x := range cols {
+		cols[x] = emptyPeak
+		from := int(float64(x) * samplesPerColumn / size)
+		to := max(int(float64(x+1)*samplesPerColumn/size), from+1)
+		for i := from; i < to && i < len(peaks); i++ {
+			cols[x] = cols[x].merge(peaks[i])
+		}
+	}
+	return cols
+}
+
+// Done reports whether Finish was called, the whole track was processed
+func (o *Overview) Done() bool {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+	return o.done
+}
+
+// ReadOverview decodes the rest of s into an Overview of a track of totalSamples samples
+func ReadOverview(s beep.Streamer, totalSamples int) (*Overview, error) {
+	o := NewOverview(totalSamples)
+	samples := make([][2]float64, 4096)
+	for {
+		n, ok := s.Stream(samples)
+		o.Process(samples[:n])
+		if !ok {
+			break
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	o.Finish()
+	return o, nil
+}
@@ -0,0 +1,115 @@
+package player
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// pcmLayout describes the uncompressed interleaved frames of a file
+type pcmLayout struct {
+	channels    int
+	width       int // bytes per sample, integer samples are left-justified within them
+	bigEndian   bool
+	float       bool   // IEEE float samples of 4 or 8 bytes
+	unsigned    bool   // e.g. 8-bit WAV samples
+	channelMask uint32 // speaker positions (WAVE_FORMAT_EXTENSIBLE), 0 for the default order of the channel count
+}
+
+// pcmDecoder streams every channel of uncompressed frames from a region of a file (e.g. a WAV data chunk),
+// it's played through a Downmix
+type pcmDecoder struct {
+	r      io.ReadSeeker
+	start  int64 // offset of the first frame
+	frames int
+	layout pcmLayout
+	pos    int
+	buf    []byte
+	err    error
+}
+
+func newPCMDecoder(r io.ReadSeeker, start int64, frames int, layout pcmLayout) (*pcmDecoder, error) {
+	if layout.channels < 1 {
+		return nil, fmt.Errorf("pcm: invalid channel count %d", layout.channels)
+	}
+	if layout.float && layout.width != 4 && layout.width != 8 {
+		return nil, fmt.Errorf("pcm: unsupported float sample width of %d bytes", layout.width)
+	}
+	if !layout.float && (layout.width < 1 || layout.width > 4) {
+		return nil, fmt.Errorf("pcm: unsupported sample width of %d bytes", layout.width)
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("pcm: %w", err)
+	}
+	return &pcmDecoder{r: r, start: start, frames: frames, layout: layout}, nil
+}
+
+// Return the sample at the start of b as a value from -1 to 1
+func (d *pcmDecoder) sample(b []byte) float64 {
+	width := d.layout.width
+	var v uint64
+	for i := range width {
+		shift := 8 * i // little-endian
+		if d.layout.bigEndian {
+			shift = 8 * (width - 1 - i)
+		}
+		v |= uint64(b[i]) << shift
+	}
+	switch {
+	case d.layout.float && width == 4:
+		return float64(math.Float32frombits(uint32(v)))
+	case d.layout.float:
+		return math.Float64frombits(v)
+	case d.layout.unsigned:
+		v ^= 1 << (8*width - 1) // offset binary to two's complement
+	}
+	v <<= 64 - 8*width // sign-extend via the top bit
+	return float64(int64(v)) / (1 << 63)
+}
+
+func (d *pcmDecoder) channels() []Channel {
+	return channelLayout(d.layout.channels, d.layout.channelMask)
+}
+
+func (d *pcmDecoder) streamFrames(samples []float64) (n int, ok bool) {
+	if d.err != nil || d.pos >= d.frames {
+		return 0, false
+	}
+	channels, width := d.layout.channels, d.layout.width
+	frameSize := channels * width
+	want := min(len(samples)/channels, d.frames-d.pos)
+	if cap(d.buf) < want*frameSize {
+		d.buf = make([]byte, want*frameSize)
+	}
+	p := d.buf[:want*frameSize]
+	read, err := io.ReadFull(d.r, p)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		d.err = fmt.Errorf("pcm: %w", err)
+		return 0, false
+	}
+	n = read / frameSize
+	for i := range n * channels {
+		samples[i] = d.sample(p[i*width:])
+	}
+	d.pos += n
+	if err == io.ErrUnexpectedEOF {
+		d.frames = d.pos // truncated file, end here
+	}
+	return n, n > 0
+}
+
+func (d *pcmDecoder) Err() error    { return d.err }
+func (d *pcmDecoder) Len() int      { return d.frames }
+func (d *pcmDecoder) Position() int { return d.pos }
+func (d *pcmDecoder) Close() error  { return nil } // the reader is owned by the caller of Decode
+
+func (d *pcmDecoder) Seek(p int) error {
+	if p < 0 || p > d.frames {
+		return fmt.Errorf("pcm: seek position %v out of range [%v, %v]", p, 0, d.frames)
+	}
+	if _, err := d.r.Seek(d.start+int64(p)*int64(d.layout.channels*d.layout.width), io.SeekStart); err != nil {
+		return fmt.Errorf("pcm: seek error: %w", err)
+	}
+	d.pos, d.err = p, nil
+	return nil
+}
@@ -0,0 +1,356 @@
+// Package player plays audio files on an Output, it's the playback core of QuickClip without any UI
+package player
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/effects"
+)
+
+// SampleRate of the Output, tracks are resampled to it
+const SampleRate beep.SampleRate = 44100
+
+const DefaultVolume = 0.7
+
+// Track is a loaded file as played by a Player, it streams at SampleRate
+// NOTE: the Player calls every method but Close with its Output locked, Close must not lock it
+type Track interface {
+	beep.Streamer
+	Format() beep.Format // format of the file, positions are counted in its samples
+	Len() int
+	Position() int
+	Seek(pos int) error
+	Remaining() int // samples at SampleRate until the end, e.g. fewer than left in the file when sped up
+	Close()
+}
+
+// Player plays one track at a time on its Output and continues with the next one set by SetNext
+type Player struct {
+	// Open is used by Load to open readers, OpenTrack when nil
+	Open func(r io.ReadCloser) (Track, error)
+	// Observe is called with every played buffer from the Output's goroutine (e.g. for meters), may be nil
+	Observe func(samples [][2]float64)
+
+	out Output
+
+	mu     sync.Mutex // guards state and volume, taken before the Output lock
+	state  State
+	volume float64
+
+	subMu       sync.Mutex // only held while publishing, never while taking another lock
+	subscribers []chan Event
+
+	// Set while holding mu and the Output lock, read while holding either
+	chain     *chain
+	ctrl      *beep.Ctrl
+	gain      *effects.Volume
+	crossfade time.Duration
+	ring      *Ring
+}
+
+// New returns a Player which plays on out
+func New(out Output) *Player {
+	return &Player{out: out, volume: DefaultVolume, ring: newRing(ringFrames)}
+}
+
+// Load opens r and replaces the current track with it, paused at the start
+// Subscribers also receive an Error event if it can't be opened
+func (p *Player) Load(r io.ReadCloser) error {
+	open := p.Open
+	if open == nil {
+		open = OpenTrack
+	}
+	track, err := open(r)
+	if err != nil {
+		p.publish(Error{Err: err})
+		return err
+	}
+	p.LoadTrack(track)
+	return nil
+}
+
+// LoadTrack replaces the current track with track, paused at the start
+func (p *Player) LoadTrack(track Track) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ejectLocked()
+	p.startLocked(track)
+	p.setStateLocked(Paused)
+	p.publish(TrackLoaded{Track: track})
+}
+
+// Hand track to the Output, paused, caller must hold mu
+func (p *Player) startLocked(track Track) {
+	c := newChain(track)
+	c.onSwitch = func(next Track) { go p.switched(c, next) }
+	c.onEnd = func() { go p.finished(c) }
+	c.onError = func(err error) { p.publish(Error{Err: err}) }
+	c.onPosition = func(current Track) {
+		rate := current.Format().SampleRate
+		p.publish(PositionChanged{Position: rate.D(current.Position()), Duration: rate.D(current.Len())})
+	}
+	ctrl := &beep.Ctrl{Streamer: &tap{s: c, ring: p.ring, observe: p.Observe}, Paused: true}
+	gain := &effects.Volume{Streamer: ctrl, Base: 2}
+	setGain(gain, p.volume)
+
+	p.out.Lock()
+	c.crossfade = p.crossfade // written by SetCrossfade with only the Output lock held
+	p.chain, p.ctrl, p.gain = c, ctrl, gain
+	p.out.Unlock()
+	p.out.Play(gain)
+}
+
+// Change the state and notify subscribers, caller must hold mu
+func (p *Player) setStateLocked(to State) error {
+	from := p.state
+	if from == to {
+		return nil
+	}
+	if !canTransition(from, to) {
+		return &TransitionError{From: from, To: to}
+	}
+	p.state = to
+	p.publish(StateChanged{From: from, To: to})
+	return nil
+}
+
+// Play starts or resumes playback, a finished player starts over from the beginning of the last track
+func (p *Player) Play() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.state == Finished {
+		p.out.Lock()
+		track := p.chain.current
+		err := track.Seek(0)
+		if err == nil { // keep it in the chain on errors so Play can be retried
+			p.chain.current = nil // the chain doesn't own it anymore
+		}
+		p.out.Unlock()
+		if err != nil {
+			return err
+		}
+		p.startLocked(track)
+	}
+	if err := p.setStateLocked(Playing); err != nil {
+		return err
+	}
+	p.out.Lock()
+	p.ctrl.Paused = false
+	p.out.Unlock()
+	return nil
+}
+
+// Pause playback, Play resumes it
+func (p *Player) Pause() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.chain == nil { // NotInitialized may only change to Paused by loading a track
+		return &TransitionError{From: p.state, To: Paused}
+	}
+	if err := p.setStateLocked(Paused); err != nil {
+		return err
+	}
+	p.out.Lock()
+	p.ctrl.Paused = true
+	p.out.Unlock()
+	return nil
+}
+
+// Eject stops playback and closes the loaded tracks
+func (p *Player) Eject() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ejectLocked()
+}
+
+func (p *Player) ejectLocked() {
+	if p.chain == nil {
+		return
+	}
+	p.out.Clear()
+	p.out.Lock()
+	c := p.chain
+	p.chain, p.ctrl, p.gain = nil, nil, nil
+	c.close()
+	p.out.Unlock()
+	p.ring.Reset()
+	p.setStateLocked(NotInitialized)
+}
+
+// Called once the chain played the last sample of its last track
+func (p *Player) finished(c *chain) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.chain != c { // ejected or loaded something else in the meantime
+		return
+	}
+	p.ring.Reset()
+	p.setStateLocked(Finished)
+}
+
+// Called once the chain continued with next
+func (p *Player) switched(c *chain, next Track) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.chain != c {
+		return
+	}
+	p.publish(TrackLoaded{Track: next, Gapless: true})
+}
+
+// SetNext prepares next to play after current without a gap (or crossfaded, see SetCrossfade)
+// It returns false without using next if current isn't the playing track anymore or another track is already prepared
+func (p *Player) SetNext(current, next Track) bool {
+	p.out.Lock()
+	defer p.out.Unlock()
+	if p.chain == nil || p.chain.current != current || p.chain.next != nil {
+		return false
+	}
+	p.chain.next = next
+	return true
+}
+
+// SetCrossfade sets the crossfade between tracks continued with SetNext, 0 plays them back to back
+func (p *Player) SetCrossfade(d time.Duration) {
+	p.out.Lock()
+	defer p.out.Unlock()
+	p.crossfade = min(max(d, 0), MaxCrossfade)
+	if p.chain != nil {
+		p.chain.crossfade = p.crossfade
+	}
+}
+
+func (p *Player) Crossfade() time.Duration {
+	p.out.Lock()
+	defer p.out.Unlock()
+	return p.crossfade
+}
+
+// State returns the current state
+func (p *Player) State() State {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.state
+}
+
+// Track returns the playing track, nil if nothing is loaded
+func (p *Player) Track() Track {
+	p.out.Lock()
+	defer p.out.Unlock()
+	if p.chain == nil {
+		return nil
+	}
+	return p.chain.current
+}
+
+// Seek to pos of the current track, clamped within the track
+func (p *Player) Seek(pos time.Duration) error {
+	p.out.Lock()
+	defer p.out.Unlock()
+	if p.chain == nil || p.chain.current == nil {
+		return fmt.Errorf("seek: nothing loaded")
+	}
+	track := p.chain.current
+	return track.Seek(min(max(track.Format().SampleRate.N(pos), 0), track.Len()-1))
+}
+
+// SeekRatio seeks to ratio from 0.0 to 1.0 of the current track (e.g. from a progress bar position)
+func (p *Player) SeekRatio(ratio float32) error {
+	p.out.Lock()
+	defer p.out.Unlock()
+	if p.chain == nil || p.chain.current == nil {
+		return fmt.Errorf("seekRatio: nothing loaded")
+	}
+	track := p.chain.current
+	if track.Len() <= 1 {
+		return nil
+	}
+	ratio = min(max(ratio, 0.0), 1.0)
+	return track.Seek(min(int(ratio*float32(track.Len()-1)), track.Len()-1))
+}
+
+// Position returns the playback position in the current track
+func (p *Player) Position() time.Duration {
+	p.out.Lock()
+	defer p.out.Unlock()
+	if p.chain == nil || p.chain.current == nil {
+		return 0
+	}
+	track := p.chain.current
+	return track.Format().SampleRate.D(track.Position())
+}
+
+// Duration returns the length of the current track
+func (p *Player) Duration() time.Duration {
+	p.out.Lock()
+	defer p.out.Unlock()
+	if p.chain == nil || p.chain.current == nil {
+		return 0
+	}
+	track := p.chain.current
+	return track.Format().SampleRate.D(track.Len())
+}
+
+// Progress returns the position as a ratio from 0.0 to 1.0 of the current track (e.g. for progress bars)
+func (p *Player) Progress() float32 {
+	p.out.Lock()
+	defer p.out.Unlock()
+	if p.chain == nil || p.chain.current == nil || p.chain.current.Len() <= 0 {
+		return 0
+	}
+	return float32(p.chain.current.Position()) / float32(p.chain.current.Len())
+}
+
+// Remaining returns the time left until the current track ends at its current speed
+func (p *Player) Remaining() time.Duration {
+	p.out.Lock()
+	defer p.out.Unlock()
+	if p.chain == nil || p.chain.current == nil {
+		return 0
+	}
+	remaining := p.chain.current.Remaining()
+	if remaining >= math.MaxInt64/int(time.Second) { // e.g. looping forever
+		return math.MaxInt64
+	}
+	return SampleRate.D(remaining)
+}
+
+// SetVolume sets the volume from 0.0 (silent) to 1.0 (full volume)
+func (p *Player) SetVolume(level float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.volume = min(max(level, 0), 1)
+	p.out.Lock()
+	defer p.out.Unlock()
+	if p.gain != nil {
+		setGain(p.gain, p.volume)
+	}
+}
+
+// Volume returns the volume from 0.0 to 1.0
+func (p *Player) Volume() float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.volume
+}
+
+// Map a volume from 0.0 to 1.0 to a range of 60dB
+func setGain(gain *effects.Volume, level float64) {
+	if level == 0.0 {
+		gain.Silent = true
+		return
+	}
+	dB := 60 * (level - 1)
+	gain.Volume = dB / 10
+	gain.Silent = false
+}
+
+// Ring returns the latest played frames for visualizations
+func (p *Player) Ring() *Ring {
+	return p.ring
+}
@@ -0,0 +1,338 @@
+package player
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// fakeOutput pulls its streamers from its own goroutine like the speaker does
+type fakeOutput struct {
+	mu        sync.Mutex
+	streamers []beep.Streamer
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+func newFakeOutput() *fakeOutput {
+	o := &fakeOutput{stop: make(chan struct{}), done: make(chan struct{})}
+	go o.run()
+	return o
+}
+
+func (o *fakeOutput) run() {
+	defer close(o.done)
+	samples := make([][2]float64, 512)
+	for {
+		select {
+		case <-o.stop:
+			return
+		default:
+		}
+		o.mu.Lock()
+		playing := o.streamers[:0]
+		for _, s := range o.streamers {
+			if _, ok := s.Stream(samples); ok {
+				playing = append(playing, s)
+			}
+		}
+		o.streamers = playing
+		o.mu.Unlock()
+		time.Sleep(100 * time.Microsecond)
+	}
+}
+
+func (o *fakeOutput) close() {
+	close(o.stop)
+	<-o.done
+}
+
+func (o *fakeOutput) Play(s beep.Streamer) {
+	o.mu.Lock()
+	o.streamers = append(o.streamers, s)
+	o.mu.Unlock()
+}
+
+func (o *fakeOutput) Clear() {
+	o.mu.Lock()
+	o.streamers = nil
+	o.mu.Unlock()
+}
+
+func (o *fakeOutput) Lock()   { o.mu.Lock() }
+func (o *fakeOutput) Unlock() { o.mu.Unlock() }
+
+// fakeTrack plays length samples of value at SampleRate
+type fakeTrack struct {
+	value   float64
+	length  int
+	pos     int
+	seekErr error // returned by Seek when set
+	closed  atomic.Bool
+}
+
+func (t *fakeTrack) Stream(samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) && t.pos < t.length {
+		samples[n] = [2]float64{t.value, t.value}
+		n++
+		t.pos++
+	}
+	return n, n > 0
+}
+
+func (t *fakeTrack) Err() error { return nil }
+func (t *fakeTrack) Format() beep.Format {
+	return beep.Format{SampleRate: SampleRate, NumChannels: 2, Precision: 2}
+}
+func (t *fakeTrack) Len() int       { return t.length }
+func (t *fakeTrack) Position() int  { return t.pos }
+func (t *fakeTrack) Remaining() int { return t.length - t.pos }
+func (t *fakeTrack) Close()         { t.closed.Store(true) }
+
+func (t *fakeTrack) Seek(pos int) error {
+	if t.seekErr != nil {
+		return t.seekErr
+	}
+	t.pos = min(max(pos, 0), t.length)
+	return nil
+}
+
+// Return the next event of the given type, failing the test if none arrives in time
+func waitForEvent[E Event](t *testing.T, events <-chan Event, match func(E) bool) E {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if e, ok := event.(E); ok && match(e) {
+				return e
+			}
+		case <-timeout:
+			var e E
+			t.Fatalf("no %T event received", e)
+			return e
+		}
+	}
+}
+
+func TestPlayerConcurrentControl(t *testing.T) {
+	out := newFakeOutput()
+	defer out.close()
+	p := New(out)
+
+	var tracksMu sync.Mutex
+	var tracks []*fakeTrack
+	newTrack := func() *fakeTrack {
+		track := &fakeTrack{value: 0.5, length: SampleRate.N(200 * time.Millisecond)}
+		tracksMu.Lock()
+		tracks = append(tracks, track)
+		tracksMu.Unlock()
+		return track
+	}
+	p.Open = func(r io.ReadCloser) (Track, error) { return newTrack(), nil }
+
+	// Keep a subscriber reading and another one coming and going while events are published
+	events, unsubscribe := p.Subscribe()
+	defer unsubscribe()
+	stopReading := make(chan struct{})
+	var readers sync.WaitGroup
+	readers.Add(1)
+	go func() {
+		defer readers.Done()
+		for {
+			select {
+			case <-events:
+			case <-stopReading:
+				return
+			}
+		}
+	}()
+
+	const iterations = 200
+	var wg sync.WaitGroup
+	run := func(action func(i int)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range iterations {
+				action(i)
+			}
+		}()
+	}
+	run(func(int) { p.Load(io.NopCloser(nil)) })
+	run(func(int) { p.Play() })
+	run(func(int) { p.Pause() })
+	run(func(i int) { p.Seek(time.Duration(i) * time.Millisecond) })
+	run(func(i int) { p.SeekRatio(float32(i) / iterations) })
+	run(func(i int) {
+		if i%10 == 0 {
+			p.Eject()
+		}
+	})
+	run(func(int) {
+		if current := p.Track(); current != nil {
+			next := newTrack()
+			if !p.SetNext(current, next) {
+				next.Close()
+			}
+		}
+	})
+	run(func(i int) {
+		p.SetVolume(float64(i) / iterations)
+		p.SetCrossfade(time.Duration(i%3) * 50 * time.Millisecond)
+	})
+	run(func(int) {
+		p.State()
+		p.Position()
+		p.Duration()
+		p.Progress()
+		p.Remaining()
+	})
+	run(func(int) {
+		frames := make([][2]float32, 256)
+		p.Ring().ReadFrames(frames)
+		p.Ring().Written()
+	})
+	run(func(int) {
+		ch, unsubscribe := p.Subscribe()
+		select {
+		case <-ch:
+		default:
+		}
+		unsubscribe()
+	})
+	wg.Wait()
+
+	p.Eject()
+	close(stopReading)
+	readers.Wait()
+	if state := p.State(); state != NotInitialized {
+		t.Errorf("state after Eject = %v, want %v", state, NotInitialized)
+	}
+	tracksMu.Lock()
+	defer tracksMu.Unlock()
+	for i, track := range tracks {
+		if !track.closed.Load() {
+			t.Errorf("track %d of %d wasn't closed", i, len(tracks))
+		}
+	}
+}
+
+func TestPlayerGaplessAndFinished(t *testing.T) {
+	out := newFakeOutput()
+	defer out.close()
+	p := New(out)
+	events, unsubscribe := p.Subscribe()
+	defer unsubscribe()
+
+	first := &fakeTrack{value: 0.25, length: SampleRate.N(50 * time.Millisecond)}
+	second := &fakeTrack{value: 0.75, length: SampleRate.N(50 * time.Millisecond)}
+	p.LoadTrack(first)
+	if !p.SetNext(first, second) {
+		t.Fatal("SetNext rejected the next track")
+	}
+	if p.SetNext(first, &fakeTrack{}) {
+		t.Error("SetNext accepted a second next track")
+	}
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := waitForEvent(t, events, func(e TrackLoaded) bool { return e.Gapless })
+	if loaded.Track != second {
+		t.Errorf("continued with %v, want the next track", loaded.Track)
+	}
+	waitForEvent(t, events, func(e StateChanged) bool { return e.To == Finished })
+	if !first.closed.Load() {
+		t.Error("first track wasn't closed after switching to the next one")
+	}
+	if p.Track() != second {
+		t.Error("finished player doesn't keep the last track")
+	}
+
+	// Finishing resets the ring to silence
+	frames := make([][2]float32, 16)
+	p.Ring().ReadFrames(frames)
+	for _, frame := range frames {
+		if frame != [2]float32{} {
+			t.Fatalf("ring not reset after finishing, got %v", frame)
+		}
+	}
+
+	// Play starts the finished track over
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, events, func(e StateChanged) bool { return e.To == Finished })
+	p.Eject()
+	if !second.closed.Load() {
+		t.Error("last track wasn't closed by Eject")
+	}
+}
+
+func TestPlayerFinishedSeekError(t *testing.T) {
+	out := newFakeOutput()
+	defer out.close()
+	p := New(out)
+	events, unsubscribe := p.Subscribe()
+	defer unsubscribe()
+
+	track := &fakeTrack{value: 0.5, length: SampleRate.N(20 * time.Millisecond)}
+	p.LoadTrack(track)
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, events, func(e StateChanged) bool { return e.To == Finished })
+
+	// A failed rewind keeps the track loaded so Play can be retried
+	out.Lock()
+	track.seekErr = errors.New("seek failed")
+	out.Unlock()
+	if err := p.Play(); err == nil {
+		t.Fatal("Play didn't return the Seek error")
+	}
+	if p.Track() != track || p.State() != Finished {
+		t.Errorf("after the failed Play the track is %v in state %v", p.Track(), p.State())
+	}
+	if err := p.Play(); err == nil {
+		t.Fatal("Play didn't return the Seek error again")
+	}
+
+	out.Lock()
+	track.seekErr = nil
+	out.Unlock()
+	if err := p.Play(); err != nil {
+		t.Fatal(err)
+	}
+	waitForEvent(t, events, func(e StateChanged) bool { return e.To == Finished })
+	p.Eject()
+	if !track.closed.Load() {
+		t.Error("track wasn't closed by Eject")
+	}
+}
+
+func TestRingReadFrames(t *testing.T) {
+	r := newRing(4)
+	r.write([][2]float64{{1, 1}, {2, 2}, {3, 3}, {4, 4}, {5, 5}, {6, 6}})
+	dst := make([][2]float32, 3)
+	r.ReadFrames(dst)
+	want := [][2]float32{{4, 4}, {5, 5}, {6, 6}}
+	for i := range dst {
+		if dst[i] != want[i] {
+			t.Fatalf("ReadFrames = %v, want %v", dst, want)
+		}
+	}
+	if r.Written() != 6 {
+		t.Errorf("Written = %d, want 6", r.Written())
+	}
+	r.Reset()
+	r.ReadFrames(dst)
+	if r.Written() != 0 || dst[2] != [2]float32{} {
+		t.Errorf("Reset didn't clear the ring: %v", dst)
+	}
+}
@@ -0,0 +1,83 @@
+package player
+
+import (
+	"sync"
+
+	"github.com/gopxl/beep/v2"
+)
+
+const ringFrames = int(SampleRate) // 1 second of stereo audio
+
+// Ring keeps the latest played frames for visualizations, it's written by the Output's goroutine and safe to read from any other
+type Ring struct {
+	mu      sync.Mutex
+	frames  [][2]float32
+	written int // frames written since the last reset, the write position is written % len(frames)
+}
+
+func newRing(size int) *Ring {
+	return &Ring{frames: make([][2]float32, size)}
+}
+
+// Len returns the number of frames the ring holds
+func (r *Ring) Len() int {
+	return len(r.frames)
+}
+
+// Written returns the number of frames written since the last reset, it doesn't change while nothing plays
+func (r *Ring) Written() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.written
+}
+
+func (r *Ring) write(samples [][2]float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, sample := range samples {
+		r.frames[r.written%len(r.frames)] = [2]float32{float32(sample[0]), float32(sample[1])}
+		r.written++
+	}
+}
+
+// ReadFrames fills dst with the most recent frames, oldest first
+func (r *Ring) ReadFrames(dst [][2]float32) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	total := len(r.frames)
+	start := ((r.written-len(dst))%total + total) % total
+	for i := range dst {
+		dst[i] = r.frames[(start+i)%total]
+	}
+}
+
+// Reset clears the ring to silence
+func (r *Ring) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	clear(r.frames)
+	r.written = 0
+}
+
+// tap passes the samples of s through while capturing them in a Ring
+type tap struct {
+	s       beep.Streamer
+	ring    *Ring
+	observe func(samples [][2]float64) // may be nil
+}
+
+func (t *tap) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = t.s.Stream(samples)
+	if n == 0 {
+		return n, ok
+	}
+	t.ring.write(samples[:n])
+	if t.observe != nil {
+		t.observe(samples[:n])
+	}
+	return n, ok
+}
+
+func (t *tap) Err() error {
+	return t.s.Err()
+}
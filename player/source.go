@@ -0,0 +1,225 @@
+package player
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const cacheChunkSize = 256 * 1024
+const maxCachedChunks = 64 // 16 MiB per source whose chunks can be read again
+
+// Source hands out independent readers over the same file
+// so playback, background analysis and clip export don't move each other's position
+type Source interface {
+	NewReader() io.ReadSeeker
+}
+
+// Wrap the reader from the file explorer as a Source without reading the whole file up front
+// Random access files (e.g. *os.File) are used directly, other readers are cached lazily in chunks
+func MakeSeekable(r io.ReadCloser) (Source, error) {
+	if sr, ok := r.(*sourceReader); ok { // replaying a source that was already wrapped
+		return sr.src, nil
+	}
+
+	rs, ok := r.(io.ReadSeeker)
+	if !ok {
+		return newChunkCache(r, nil, -1), nil
+	}
+
+	size, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't determine source size: %w", err)
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("couldn't reset source position: %w", err)
+	}
+
+	ra, ok := r.(io.ReaderAt)
+	if !ok { // e.g. android and iOS files, cached so every small read isn't a seek
+		return newChunkCache(rs, rs, size), nil
+	}
+	return &readerAtSource{ra: ra, size: size}, nil
+}
+
+// sourceReader is an io.ReadSeekCloser over a Source that MakeSeekable unwraps again
+// so sources which can't be reopened (e.g. forward-only readers) can be played more than once
+type sourceReader struct {
+	io.ReadSeeker
+	src Source
+}
+
+func NewSourceReader(src Source) io.ReadCloser {
+	return &sourceReader{ReadSeeker: src.NewReader(), src: src}
+}
+
+func (s *sourceReader) Close() error {
+	return nil // no-op; the Source doesn't own an underlying file
+}
+
+// readerAtSource is a Source for random access files
+type readerAtSource struct {
+	ra   io.ReaderAt
+	size int64
+}
+
+func (s *readerAtSource) NewReader() io.ReadSeeker {
+	return io.NewSectionReader(s.ra, 0, s.size)
+}
+
+// chunkCache makes a reader seekable by caching it in chunks as they're read
+// Seekable sources keep the maxCachedChunks most recently used chunks and read evicted ones again
+// NOTE: a forward-only source can't be read twice so its chunks are kept for the life of the cache
+type chunkCache struct {
+	mu     sync.Mutex
+	src    io.Reader
+	seeker io.Seeker // src if it can seek, nil for forward-only sources
+	size   int64     // -1 until known
+	chunks map[int64]*list.Element
+	lru    *list.List // of *cachedChunk, most recently used first
+	next   int64      // index of the chunk src reads next
+	err    error      // sticky read error of a forward-only source
+}
+
+type cachedChunk struct {
+	index int64
+	data  []byte // cacheChunkSize bytes except for the last chunk
+}
+
+func newChunkCache(r io.Reader, seeker io.Seeker, size int64) *chunkCache {
+	return &chunkCache{src: r, seeker: seeker, size: size, chunks: make(map[int64]*list.Element), lru: list.New()}
+}
+
+// Return chunk index, reading it from src if it isn't cached, caller must hold mu
+func (c *chunkCache) chunkLocked(index int64) ([]byte, error) {
+	if e, ok := c.chunks[index]; ok {
+		c.lru.MoveToFront(e)
+		return e.Value.(*cachedChunk).data, nil
+	}
+	if c.size >= 0 && index*cacheChunkSize >= c.size {
+		return nil, io.EOF
+	}
+
+	if c.seeker != nil {
+		if c.next != index {
+			if _, err := c.seeker.Seek(index*cacheChunkSize, io.SeekStart); err != nil {
+				return nil, err
+			}
+			c.next = index
+		}
+		return c.readChunkLocked()
+	}
+
+	if index < c.next { // never evicted, see chunkCache
+		return nil, fmt.Errorf("chunkCache: chunk %d is missing", index)
+	}
+	for c.err == nil {
+		data, err := c.readChunkLocked()
+		if err != nil {
+			c.err = err
+			break
+		}
+		if c.next > index {
+			return data, nil
+		}
+	}
+	return nil, c.err
+}
+
+// Read the chunk at c.next from src and cache it, caller must hold mu
+func (c *chunkCache) readChunkLocked() ([]byte, error) {
+	data := make([]byte, cacheChunkSize)
+	n, err := io.ReadFull(c.src, data)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		c.size = c.next*cacheChunkSize + int64(n)
+		if n == 0 {
+			return nil, io.EOF
+		}
+	} else if err != nil {
+		c.next = -1 // unknown position, seek again before the next read
+		return nil, err
+	}
+
+	data = data[:n]
+	c.chunks[c.next] = c.lru.PushFront(&cachedChunk{index: c.next, data: data})
+	c.next++
+	if c.seeker != nil && c.lru.Len() > maxCachedChunks {
+		oldest := c.lru.Remove(c.lru.Back()).(*cachedChunk)
+		delete(c.chunks, oldest.index)
+	}
+	return data, nil
+}
+
+func (c *chunkCache) ReadAt(p []byte, off int64) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		chunk, err := c.chunkLocked(pos / cacheChunkSize)
+		if err != nil {
+			return n, err
+		}
+		if pos%cacheChunkSize >= int64(len(chunk)) {
+			return n, io.EOF
+		}
+		n += copy(p[n:], chunk[pos%cacheChunkSize:])
+	}
+	return n, nil
+}
+
+// Return the total size of the source, a forward-only source has to be read to the end for it
+func (c *chunkCache) Size() (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.size < 0 {
+		if _, err := c.chunkLocked(c.next); err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+	}
+	return c.size, nil
+}
+func (c *chunkCache) NewReader() io.ReadSeeker {
+	return &cacheReader{c: c}
+}
+
+// cacheReader is an io.ReadSeeker with its own position over a chunkCache
+type cacheReader struct {
+	c   *chunkCache
+	pos int64
+}
+
+func (r *cacheReader) Read(p []byte) (int, error) {
+	n, err := r.c.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	if n > 0 && errors.Is(err, io.EOF) {
+		err = nil // report EOF on the next read like other readers
+	}
+	return n, err
+}
+
+func (r *cacheReader) Seek(offset int64, whence int) (int64, error) {
+	var newPos int64
+	switch whence {
+	case io.SeekStart:
+		newPos = offset
+	case io.SeekCurrent:
+		newPos = r.pos + offset
+	case io.SeekEnd:
+		size, err := r.c.Size()
+		if err != nil {
+			return 0, err
+		}
+		newPos = size + offset
+	default:
+		return 0, fmt.Errorf("cacheReader: invalid whence %d", whence)
+	}
+	if newPos < 0 {
+		return 0, fmt.Errorf("cacheReader: negative position")
+	}
+	r.pos = newPos
+	return newPos, nil
+}
@@ -0,0 +1,25 @@
+// Package speakerout plays a Player on beep's speaker
+// It's a separate package because the speaker needs cgo on most platforms (e.g. alsa on linux)
+package speakerout
+
+import (
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/speaker"
+	"quickClip/player"
+)
+
+// Speaker is the Output of the global speaker, Init it first
+var Speaker player.Output = speakerOutput{}
+
+// Init initializes the global speaker, this should only need to run once
+func Init() error {
+	// NOTE: fixed buffer size for wasm MUST be divisible by 2
+	return speaker.Init(player.SampleRate, 8194)
+}
+
+type speakerOutput struct{}
+
+func (speakerOutput) Play(s beep.Streamer) { speaker.Play(s) }
+func (speakerOutput) Clear()               { speaker.Clear() }
+func (speakerOutput) Lock()                { speaker.Lock() }
+func (speakerOutput) Unlock()              { speaker.Unlock() }
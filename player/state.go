@@ -0,0 +1,56 @@
+package player
+
+import (
+	"fmt"
+	"slices"
+)
+
+// State of a Player
+type State int
+
+const (
+	NotInitialized State = iota // nothing loaded
+	Paused                      // loaded, not playing
+	Playing
+	Finished // played to the end of the last track
+)
+
+func (s State) String() string {
+	switch s {
+	case NotInitialized:
+		return "not initialized"
+	case Paused:
+		return "paused"
+	case Playing:
+		return "playing"
+	case Finished:
+		return "finished"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Allowed state changes besides ejecting, which returns to NotInitialized from any state
+var transitions = map[State][]State{
+	NotInitialized: {Paused}, // loaded
+	Paused:         {Playing},
+	Playing:        {Paused, Finished},
+	Finished:       {Playing},
+}
+
+// canTransition reports whether a player in state from may change to state to
+func canTransition(from, to State) bool {
+	if to == NotInitialized {
+		return true
+	}
+	return slices.Contains(transitions[from], to)
+}
+
+// TransitionError is returned when a Player method isn't allowed in the current state, e.g. Pause while Finished
+type TransitionError struct {
+	From, To State
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("can't change from %v to %v", e.From, e.To)
+}
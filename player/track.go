@@ -0,0 +1,44 @@
+package player
+
+import (
+	"io"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// decodedTrack plays a file as decoded, resampled to SampleRate
+type decodedTrack struct {
+	decoder   beep.StreamSeekCloser
+	format    beep.Format
+	resampler *beep.Resampler
+}
+
+// OpenTrack decodes r with the decoder picked by Decode, without any effects
+func OpenTrack(r io.ReadCloser) (Track, error) {
+	source, err := MakeSeekable(r)
+	if err != nil {
+		return nil, err
+	}
+	decoder, format, _, err := Decode(source.NewReader())
+	if err != nil {
+		return nil, err
+	}
+	return &decodedTrack{
+		decoder:   decoder,
+		format:    format,
+		resampler: beep.Resample(4, format.SampleRate, SampleRate, decoder),
+	}, nil
+}
+
+func (t *decodedTrack) Stream(samples [][2]float64) (int, bool) { return t.resampler.Stream(samples) }
+func (t *decodedTrack) Err() error                              { return t.resampler.Err() }
+func (t *decodedTrack) Format() beep.Format                     { return t.format }
+func (t *decodedTrack) Len() int                                { return t.decoder.Len() }
+func (t *decodedTrack) Position() int                           { return t.decoder.Position() }
+func (t *decodedTrack) Seek(pos int) error                      { return t.decoder.Seek(pos) }
+func (t *decodedTrack) Close()                                  { t.decoder.Close() }
+
+func (t *decodedTrack) Remaining() int {
+	left := t.decoder.Len() - t.decoder.Position()
+	return int(float64(left) * float64(SampleRate) / float64(t.format.SampleRate))
+}
@@ -0,0 +1,81 @@
+package player
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// Format tags of the WAV fmt chunk
+const (
+	wavePCM        = 0x0001
+	waveFloat      = 0x0003
+	waveExtensible = 0xFFFE // the actual format is the first two bytes of the SubFormat GUID
+)
+
+// Decode a WAV, RF64 or BW64 file with 8 to 32-bit integer or 32/64-bit float samples,
+// including WAVE_FORMAT_EXTENSIBLE files with more than two channels
+func decodeWAV(r io.ReadSeeker) (beep.StreamSeekCloser, beep.Format, error) {
+	form, chunks, err := ReadChunks(r)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("wav: %w", err)
+	}
+	if form != "WAVE" {
+		return nil, beep.Format{}, fmt.Errorf("wav: not a WAV file")
+	}
+	var fmtChunk, data *Chunk
+	for i := range chunks {
+		switch chunks[i].ID {
+		case "fmt ":
+			fmtChunk = &chunks[i]
+		case "data":
+			data = &chunks[i]
+		}
+	}
+	if fmtChunk == nil || data == nil {
+		return nil, beep.Format{}, fmt.Errorf("wav: missing fmt or data chunk")
+	}
+
+	header, err := ReadChunk(r, *fmtChunk)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("wav: %w", err)
+	}
+	if len(header) < 16 {
+		return nil, beep.Format{}, fmt.Errorf("wav: fmt chunk too short")
+	}
+	formatTag := binary.LittleEndian.Uint16(header[0:])
+	channels := int(binary.LittleEndian.Uint16(header[2:]))
+	sampleRate := binary.LittleEndian.Uint32(header[4:])
+	bits := int(binary.LittleEndian.Uint16(header[14:]))
+	var channelMask uint32
+	if formatTag == waveExtensible {
+		if len(header) < 40 {
+			return nil, beep.Format{}, fmt.Errorf("wav: WAVE_FORMAT_EXTENSIBLE fmt chunk too short")
+		}
+		channelMask = binary.LittleEndian.Uint32(header[20:])
+		formatTag = binary.LittleEndian.Uint16(header[24:])
+	}
+	if channels < 1 || sampleRate == 0 {
+		return nil, beep.Format{}, fmt.Errorf("wav: invalid format with %d channels at %d Hz", channels, sampleRate)
+	}
+	if formatTag != wavePCM && formatTag != waveFloat {
+		return nil, beep.Format{}, fmt.Errorf("wav: unsupported format tag %#04x", formatTag)
+	}
+
+	width := (bits + 7) / 8 // the container size, WAVE_FORMAT_EXTENSIBLE has the valid bits separately
+	layout := pcmLayout{
+		channels:    channels,
+		width:       width,
+		float:       formatTag == waveFloat,
+		unsigned:    formatTag == wavePCM && width == 1,
+		channelMask: channelMask,
+	}
+	d, err := newPCMDecoder(r, data.Offset, int(data.Size/int64(channels*max(width, 1))), layout)
+	if err != nil {
+		return nil, beep.Format{}, fmt.Errorf("wav: %w", err)
+	}
+	format := beep.Format{SampleRate: beep.SampleRate(sampleRate), NumChannels: min(d.layout.channels, 2), Precision: d.layout.width}
+	return newDownmix(d), format, nil
+}
@@ -0,0 +1,165 @@
+package player
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+)
+
+type wavTestChunk struct {
+	id   string
+	size uint32 // written instead of the size of data when not 0, e.g. 0xFFFFFFFF in RF64 files
+	data []byte
+}
+
+// Return a WAV file of chunks in a RIFF, RF64 or BW64 container
+func wavTestFile(container string, chunks ...wavTestChunk) []byte {
+	var body []byte
+	for _, c := range chunks {
+		size := c.size
+		if size == 0 {
+			size = uint32(len(c.data))
+		}
+		body = append(body, c.id...)
+		body = binary.LittleEndian.AppendUint32(body, size)
+		body = append(body, c.data...)
+		if len(c.data)%2 != 0 {
+			body = append(body, 0)
+		}
+	}
+	size := uint32(4 + len(body))
+	if container != "RIFF" {
+		size = math.MaxUint32
+	}
+	file := binary.LittleEndian.AppendUint32([]byte(container), size)
+	return append(append(file, "WAVE"...), body...)
+}
+
+// Return a fmt chunk, WAVE_FORMAT_EXTENSIBLE with subFormat as its format when mask isn't 0
+func wavTestFmt(tag uint16, channels int, bits int, mask uint32) wavTestChunk {
+	format := tag
+	if mask != 0 {
+		format = waveExtensible
+	}
+	data := binary.LittleEndian.AppendUint16(nil, format)
+	data = binary.LittleEndian.AppendUint16(data, uint16(channels))
+	data = binary.LittleEndian.AppendUint32(data, 48000)
+	data = binary.LittleEndian.AppendUint32(data, uint32(48000*channels*bits/8))
+	data = binary.LittleEndian.AppendUint16(data, uint16(channels*bits/8))
+	data = binary.LittleEndian.AppendUint16(data, uint16(bits))
+	if mask != 0 {
+		data = binary.LittleEndian.AppendUint16(data, 22)
+		data = binary.LittleEndian.AppendUint16(data, uint16(bits))
+		data = binary.LittleEndian.AppendUint32(data, mask)
+		data = binary.LittleEndian.AppendUint16(data, tag) // the rest of the KSDATAFORMAT_SUBTYPE GUID
+		data = append(data, 0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71)
+	}
+	return wavTestChunk{id: "fmt ", data: data}
+}
+
+// Return a ds64 chunk of an RF64 file whose data chunk has dataSize bytes
+func wavTestDS64(dataSize uint64) wavTestChunk {
+	data := binary.LittleEndian.AppendUint64(nil, 0) // RIFF size, unused
+	data = binary.LittleEndian.AppendUint64(data, dataSize)
+	data = binary.LittleEndian.AppendUint64(data, 0) // sample count
+	data = binary.LittleEndian.AppendUint32(data, 0) // table length
+	return wavTestChunk{id: "ds64", data: data}
+}
+
+func float32Bytes(values ...float32) []byte {
+	var b []byte
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	return b
+}
+
+func TestDecodeWAV(t *testing.T) {
+	pcm16 := []byte{0x00, 0x40, 0x00, 0xc0, 0x00, 0x20, 0x00, 0xe0} // 0.5, -0.5, 0.25, -0.25
+	pcm24 := []byte{0x00, 0x00, 0x40, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x20, 0x00, 0x00, 0xe0}
+	float64Data := binary.LittleEndian.AppendUint64(nil, math.Float64bits(0.5))
+	float64Data = binary.LittleEndian.AppendUint64(float64Data, math.Float64bits(-0.5))
+	stereo := [][2]float64{{0.5, -0.5}, {0.25, -0.25}}
+	list := wavTestChunk{id: "LIST", data: []byte("INFOISFT\x04\x00\x00\x00test")} // read as samples if the data size is wrong
+
+	tests := []struct {
+		name      string
+		file      []byte
+		precision int
+		want      [][2]float64
+		wantErr   bool
+	}{
+		{"PCM", wavTestFile("RIFF", wavTestFmt(wavePCM, 2, 16, 0), wavTestChunk{id: "data", data: pcm16}, list), 2, stereo, false},
+		{"unsigned 8 bit", wavTestFile("RIFF", wavTestFmt(wavePCM, 1, 8, 0), wavTestChunk{id: "data", data: []byte{0xc0, 0x40}}), 1, [][2]float64{{0.5, 0.5}, {-0.5, -0.5}}, false},
+		{"extensible 24 bit", wavTestFile("RIFF", wavTestFmt(wavePCM, 2, 24, 0x3), wavTestChunk{id: "data", data: pcm24}), 3, stereo, false},
+		{"extensible float", wavTestFile("RIFF", wavTestFmt(waveFloat, 2, 32, 0x3), wavTestChunk{id: "data", data: float32Bytes(0.5, -0.5, 0.25, -0.25)}), 4, stereo, false},
+		{"64 bit float", wavTestFile("RIFF", wavTestFmt(waveFloat, 2, 64, 0), wavTestChunk{id: "data", data: float64Data}), 8, [][2]float64{{0.5, -0.5}}, false},
+		{"RF64", wavTestFile("RF64", wavTestDS64(uint64(len(pcm16))), wavTestFmt(wavePCM, 2, 16, 0), wavTestChunk{id: "data", size: math.MaxUint32, data: pcm16}, list), 2, stereo, false},
+		{"BW64", wavTestFile("BW64", wavTestDS64(uint64(len(pcm16))), wavTestFmt(wavePCM, 2, 16, 0), wavTestChunk{id: "data", size: math.MaxUint32, data: pcm16}, list), 2, stereo, false},
+		{"RF64 data past the end", wavTestFile("RF64", wavTestDS64(1<<40), wavTestFmt(wavePCM, 2, 16, 0), wavTestChunk{id: "data", size: math.MaxUint32, data: pcm16}), 2, stereo, false},
+		{"extensible fmt too short", wavTestFile("RIFF", wavTestChunk{id: "fmt ", data: wavTestFmt(wavePCM, 2, 16, 0x3).data[:24]}, wavTestChunk{id: "data", data: pcm16}), 0, nil, true},
+		{"compressed", wavTestFile("RIFF", wavTestFmt(0x0002, 2, 4, 0), wavTestChunk{id: "data", data: pcm16}), 0, nil, true},
+		{"compressed extensible", wavTestFile("RIFF", wavTestFmt(0x0002, 2, 16, 0x3), wavTestChunk{id: "data", data: pcm16}), 0, nil, true},
+		{"float of 16 bits", wavTestFile("RIFF", wavTestFmt(waveFloat, 2, 16, 0), wavTestChunk{id: "data", data: pcm16}), 0, nil, true},
+		{"no channels", wavTestFile("RIFF", wavTestFmt(wavePCM, 0, 16, 0), wavTestChunk{id: "data", data: pcm16}), 0, nil, true},
+		{"missing data", wavTestFile("RIFF", wavTestFmt(wavePCM, 2, 16, 0)), 0, nil, true},
+		{"RF64 ds64 too short", wavTestFile("RF64", wavTestChunk{id: "ds64", data: make([]byte, 24)}, wavTestFmt(wavePCM, 2, 16, 0), wavTestChunk{id: "data", data: pcm16}), 0, nil, true},
+	}
+	for _, test := range tests {
+		s, format, err := decodeWAV(bytes.NewReader(test.file))
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: err = %v, want an error: %v", test.name, err, test.wantErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if format.SampleRate != 48000 || format.Precision != test.precision || s.Len() != len(test.want) {
+			t.Errorf("%s: format %+v with %d frames, want 48000 Hz, %d bytes and %d frames", test.name, format, s.Len(), test.precision, len(test.want))
+			continue
+		}
+		got := make([][2]float64, 8)
+		n, _ := s.Stream(got)
+		if !equalFrames(got[:n], test.want) {
+			t.Errorf("%s: streamed %v, want %v", test.name, got[:n], test.want)
+		}
+	}
+}
+
+func TestDecodeWAVChannelMask(t *testing.T) {
+	frame := float32Bytes(0.1, 0.2, 0.3, 0.4, 0.5, 0.6)
+	tests := []struct {
+		name string
+		mask uint32
+		want []Channel
+	}{
+		{"5.1", 0x3f, []Channel{FrontLeft, FrontRight, FrontCenter, LowFrequency, BackLeft, BackRight}},
+		{"5.1 side", 0x60f, []Channel{FrontLeft, FrontRight, FrontCenter, LowFrequency, SideLeft, SideRight}},
+		{"fewer positions than channels", 0x7, []Channel{FrontLeft, FrontRight, FrontCenter, 0, 0, 0}},
+	}
+	for _, test := range tests {
+		file := wavTestFile("RIFF", wavTestFmt(waveFloat, 6, 32, test.mask), wavTestChunk{id: "data", data: frame})
+		s, format, err := decodeWAV(bytes.NewReader(file))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		d := s.(*Downmix)
+		if channels := d.Channels(); format.NumChannels != 2 || !slices.Equal(channels, test.want) {
+			t.Errorf("%s: %d channels %v, want %v", test.name, format.NumChannels, channels, test.want)
+		}
+
+		// Played through the ITU downmix of its channels
+		var want [2]float64
+		for ch, gains := range ITUDownmix(test.want) {
+			v := float64(float32(0.1 * float64(ch+1)))
+			want[0] += v * gains[0]
+			want[1] += v * gains[1]
+		}
+		got := make([][2]float64, 1)
+		if n, _ := s.Stream(got); n != 1 || !equalFrames(got, [][2]float64{want}) {
+			t.Errorf("%s: streamed %v, want %v", test.name, got[:n], want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package waveformui
+
+import (
+	"image"
+	"image/color"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"quickClip/player"
+)
+
+// Overview draws the peaks of a whole track as a seek bar filling the maximum constraints,
+// with a gradient from color1 to color2, the played part shaded and a playhead at progress from 0 to 1
+func Overview(gtx layout.Context, overview *player.Overview, progress float32, color1, color2 color.NRGBA) layout.Dimensions {
+	width, height := gtx.Constraints.Max.X, gtx.Constraints.Max.Y
+	size := image.Pt(width, height)
+	paint.FillShape(gtx.Ops, color.NRGBA{R: 20, G: 20, B: 20, A: 255}, clip.Rect{Max: size}.Op())
+
+	cols := overview.Columns(width)
+	centerY := float32(height) / 2
+	halfHeight := float32(height) / 2
+
+	var path clip.Path
+	path.Begin(gtx.Ops)
+	for x, p := range cols {
+		if p.Min > p.Max { // not decoded yet
+			continue
+		}
+		top := centerY - p.Max*halfHeight
+		bottom := max(centerY-p.Min*halfHeight, top+1) // always show at least a pixel
+		path.MoveTo(f32.Pt(float32(x)+0.5, top))
+		path.LineTo(f32.Pt(float32(x)+0.5, bottom))
+	}
+	strokeOp := clip.Stroke{Path: path.End(), Width: 1}.Op()
+
+	// Draw gradient on top of waveform
+	clipStack := strokeOp.Push(gtx.Ops)
+	paint.LinearGradientOp{
+		Stop1:  f32.Pt(0, 0),
+		Stop2:  f32.Pt(float32(width), float32(height)),
+		Color1: color1,
+		Color2: color2,
+	}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	clipStack.Pop()
+
+	// Shade the played part and draw the playhead
+	playheadX := int(min(max(progress, 0), 1) * float32(width))
+	paint.FillShape(gtx.Ops, color.NRGBA{R: 255, G: 255, B: 255, A: 40},
+		clip.Rect{Max: image.Pt(playheadX, height)}.Op())
+	paint.FillShape(gtx.Ops, color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+		clip.Rect{Min: image.Pt(playheadX-1, 0), Max: image.Pt(playheadX+1, height)}.Op())
+
+	return layout.Dimensions{Size: size}
+}
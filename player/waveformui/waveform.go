@@ -0,0 +1,162 @@
+// Package waveformui draws the waveforms of a Player with Gio, live from its Ring and as an overview seek bar
+package waveformui
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"quickClip/player"
+)
+
+// Layouts of the live waveform
+const (
+	Mono   = "mono"   // sum of both channels, colored with a gradient between both colors
+	Lanes  = "lanes"  // left channel on top, right channel below
+	Mirror = "mirror" // left channel above the center line, right channel below
+)
+
+// Style of a live waveform
+type Style struct {
+	Layout         string      // Mono, Lanes or Mirror
+	Color1, Color2 color.NRGBA // of the left and right channel, the mono waveform is a gradient between them
+	PixelsPerFrame int         // width of the column drawn for every frame, e.g. 4 to draw fewer frames on slow devices
+}
+
+// Waveform draws the latest frames of a player.Ring, smoothing every column over the drawn frames
+type Waveform struct {
+	frames   [][2]float32
+	smoothed []float32 // smoothed levels, two per column (left and right)
+}
+
+// Layout draws the waveform of ring filling the maximum constraints
+func (w *Waveform) Layout(gtx layout.Context, ring *player.Ring, style Style) layout.Dimensions {
+	width, height := gtx.Constraints.Max.X, gtx.Constraints.Max.Y
+	numSamples := width / max(style.PixelsPerFrame, 1)
+	if numSamples <= 0 || ring.Len() < numSamples {
+		return layout.Dimensions{}
+	}
+	if len(w.frames) != numSamples {
+		w.frames = make([][2]float32, numSamples)
+	}
+	ring.ReadFrames(w.frames)
+
+	// Pre-calculate drawing parameters
+	step := float32(width) / float32(numSamples)
+	centerY := float32(height) / 2
+
+	// Draw a static center line.
+	var centerLinePath clip.Path
+	centerLinePath.Begin(gtx.Ops)
+	centerLinePath.MoveTo(f32.Pt(0, centerY))
+	centerLinePath.LineTo(f32.Pt(float32(width), centerY))
+	paint.FillShape(gtx.Ops,
+		color.NRGBA{R: 0, G: 0, B: 0, A: 255},
+		clip.Stroke{
+			Path:  centerLinePath.End(),
+			Width: 1,
+		}.Op())
+
+	if len(w.smoothed) != numSamples*2 {
+		w.smoothed = make([]float32, numSamples*2)
+	}
+
+	// Contrast parameters to make waveform more distinct
+	alpha := float32(0.25)
+	smooth := func(i, channel int, sample float32) float32 {
+		idx := i*2 + channel
+		w.smoothed[idx] = w.smoothed[idx]*(1-alpha) + Level(sample)*alpha
+		return w.smoothed[idx]
+	}
+
+	switch style.Layout {
+	case Lanes:
+		laneHeight := float32(height) / 4
+		left := ColumnPath(gtx, numSamples, step, func(i int) (float32, float32) {
+			level := smooth(i, 0, w.frames[i][0]) * laneHeight
+			return laneHeight - level, laneHeight + level
+		})
+		right := ColumnPath(gtx, numSamples, step, func(i int) (float32, float32) {
+			level := smooth(i, 1, w.frames[i][1]) * laneHeight
+			return 3*laneHeight - level, 3*laneHeight + level
+		})
+		paint.FillShape(gtx.Ops, style.Color1, left)
+		paint.FillShape(gtx.Ops, style.Color2, right)
+	case Mirror:
+		maxHeight := float32(height) / 2
+		left := ColumnPath(gtx, numSamples, step, func(i int) (float32, float32) {
+			return centerY - smooth(i, 0, w.frames[i][0])*maxHeight, centerY
+		})
+		right := ColumnPath(gtx, numSamples, step, func(i int) (float32, float32) {
+			return centerY, centerY + smooth(i, 1, w.frames[i][1])*maxHeight
+		})
+		paint.FillShape(gtx.Ops, style.Color1, left)
+		paint.FillShape(gtx.Ops, style.Color2, right)
+	default:
+		maxHeight := float32(height) / 2
+		mono := ColumnPath(gtx, numSamples, step, func(i int) (float32, float32) {
+			level := smooth(i, 0, (w.frames[i][0]+w.frames[i][1])/2) * maxHeight
+			return centerY - level, centerY + level
+		})
+
+		// Push the path as a clipping region for colorization
+		clipStack := mono.Push(gtx.Ops)
+		defer clipStack.Pop() // Ensure the clip is popped after drawing.
+
+		// Draw gradient on top of waveform
+		grad := paint.LinearGradientOp{
+			Stop1:  f32.Pt(0, 0),
+			Stop2:  f32.Pt(float32(width), float32(height)),
+			Color1: style.Color1,
+			Color2: style.Color2,
+		}
+		grad.Add(gtx.Ops)
+		paint.PaintOp{}.Add(gtx.Ops)
+	}
+	return layout.Dimensions{Size: image.Point{X: width, Y: height}}
+}
+
+// Reset clears the smoothed levels, e.g. after the player was ejected
+func (w *Waveform) Reset() {
+	clear(w.smoothed)
+}
+
+// Level maps a sample to the displayed level from 0 to 1 with the dB/contrast curve of the waveform
+func Level(sample float32) float32 {
+	dbMin := -120.0 // Silence threshold
+	exponent := float32(10.)
+
+	// Convert to dB, ensuring no log(0) issues
+	db := 20 * math.Log10(math.Max(1e-5, math.Abs(float64(sample))))
+	normalized := float32((db - dbMin) / (-dbMin))
+	return applyContrast32(normalized, exponent)
+}
+
+// ColumnPath builds a vertical line for each of numSamples columns between the y positions returned by span
+func ColumnPath(gtx layout.Context, numSamples int, step float32, span func(i int) (top, bottom float32)) clip.Op {
+	var path clip.Path
+	path.Begin(gtx.Ops)
+	for i := range numSamples {
+		top, bottom := span(i)
+		x := float32(i) * step
+		path.MoveTo(f32.Pt(x, top))
+		path.LineTo(f32.Pt(x, bottom))
+	}
+	path.Close()
+	return clip.Stroke{
+		Path:  path.End(),
+		Width: step,
+	}.Op()
+}
+
+// applyContrast applies a power function to increase contrast.
+func applyContrast32(normalized, exponent float32) float32 {
+	if normalized >= 0 {
+		return float32(math.Pow(float64(normalized), float64(exponent)))
+	}
+	return -float32(math.Pow(float64(-normalized), float64(exponent)))
+}
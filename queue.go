@@ -0,0 +1,359 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"log"
+	"math/rand/v2"
+	"path/filepath"
+	"sync"
+
+	"gioui.org/app"
+	"gioui.org/layout"
+	"gioui.org/unit"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+	"quickClip/player"
+)
+
+// RepeatMode controls what happens when the current track of the queue finishes
+type RepeatMode int
+
+const (
+	RepeatOff RepeatMode = iota
+	RepeatAll
+	RepeatOne
+)
+
+func (r RepeatMode) String() string {
+	switch r {
+	case RepeatAll:
+		return "Repeat: All"
+	case RepeatOne:
+		return "Repeat: One"
+	default:
+		return "Repeat: Off"
+	}
+}
+
+type queueEntry struct {
+	reader io.ReadCloser
+	name   string
+	click  widget.Clickable // select entry in the queue panel
+
+	mu     sync.Mutex    // guards source, entries are opened from the frame loop and while preparing
+	source player.Source // of reader, made on the first open
+}
+
+// Return a new reader of the entry at its start, every playback of it gets its own
+// so a prepared or replayed unit doesn't move the position of another one reading it
+func (e *queueEntry) open() io.ReadCloser {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.source == nil {
+		source, err := player.MakeSeekable(e.reader)
+		if err != nil {
+			log.Println("Couldn't open queue entry:", err)
+			return e.reader
+		}
+		e.source = source
+	}
+	return player.NewSourceReader(e.source)
+}
+
+// playQueue holds the opened sources and the order they're played in
+type playQueue struct {
+	mu      sync.Mutex
+	entries []*queueEntry
+	order   []int // indices into entries, shuffled when shuffle is enabled
+	pos     int   // current index into order, -1 when nothing was selected yet
+	repeat  RepeatMode
+	shuffle bool
+}
+
+var queue = &playQueue{pos: -1}
+
+var prevButton, nextButton, repeatButton, addButton widget.Clickable
+var shuffleToggle widget.Bool
+var queueList = widget.List{List: layout.List{Axis: layout.Vertical}}
+
+func newQueueEntry(r io.ReadCloser, index int) *queueEntry {
+	name := fmt.Sprintf("Track %d", index+1)
+	if named, ok := r.(interface{ Name() string }); ok { // e.g. *os.File on desktop
+		name = filepath.Base(named.Name())
+	}
+	return &queueEntry{reader: r, name: name}
+}
+
+// Replace the queue contents with readers and return the first entry to play
+func (q *playQueue) set(readers []io.ReadCloser) *queueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, e := range q.entries {
+		e.reader.Close()
+	}
+	q.entries = q.entries[:0]
+	q.appendLocked(readers)
+	q.pos = -1
+	q.rebuildOrderLocked()
+	return q.stepLocked(1, true)
+}
+
+// Append readers to the end of the queue
+func (q *playQueue) add(readers []io.ReadCloser) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.appendLocked(readers)
+	q.rebuildOrderLocked()
+}
+
+func (q *playQueue) appendLocked(readers []io.ReadCloser) {
+	for _, r := range readers {
+		q.entries = append(q.entries, newQueueEntry(r, len(q.entries)))
+	}
+}
+
+// Regenerate the play order, keeping the current entry as the current position
+func (q *playQueue) rebuildOrderLocked() {
+	current := -1
+	if q.pos >= 0 && q.pos < len(q.order) {
+		current = q.order[q.pos]
+	}
+
+	q.order = q.order[:0]
+	if !q.shuffle {
+		for i := range q.entries {
+			q.order = append(q.order, i)
+		}
+		q.pos = current
+		return
+	}
+
+	// Current track first so every other track still plays after it
+	if current >= 0 {
+		q.order = append(q.order, current)
+	}
+	for i := range q.entries {
+		if i != current {
+			q.order = append(q.order, i)
+		}
+	}
+	rest := q.order
+	if current >= 0 {
+		rest = q.order[1:]
+		q.pos = 0
+	}
+	rand.Shuffle(len(rest), func(i, j int) { rest[i], rest[j] = rest[j], rest[i] })
+}
+
+// Move dir entries through the play order, manual is true for user initiated skips which ignore RepeatOne
+func (q *playQueue) stepLocked(dir int, manual bool) *queueEntry {
+	if len(q.order) == 0 {
+		return nil
+	}
+	if q.repeat == RepeatOne && !manual && q.pos >= 0 {
+		return q.entries[q.order[q.pos]]
+	}
+
+	newPos := q.pos + dir
+	switch {
+	case newPos >= len(q.order):
+		if q.repeat != RepeatAll {
+			return nil
+		}
+		if q.shuffle { // new shuffle for every pass
+			q.pos = -1
+			q.rebuildOrderLocked()
+		}
+		newPos = 0
+	case newPos < 0:
+		if q.repeat != RepeatAll {
+			newPos = 0
+		} else {
+			newPos = len(q.order) - 1
+		}
+	}
+	q.pos = newPos
+	return q.entries[q.order[q.pos]]
+}
+
+// Advance to the next entry, nil if the end of the queue was reached
+func (q *playQueue) next(manual bool) *queueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stepLocked(1, manual)
+}
+
+// Return the entry next(false) would advance to without moving the queue
+func (q *playQueue) peekNext() *queueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.order) == 0 || q.pos < 0 {
+		return nil
+	}
+	if q.repeat == RepeatOne {
+		return q.entries[q.order[q.pos]]
+	}
+	newPos := q.pos + 1
+	if newPos >= len(q.order) {
+		if q.repeat != RepeatAll {
+			return nil
+		}
+		newPos = 0
+	}
+	return q.entries[q.order[newPos]]
+}
+
+func (q *playQueue) previous() *queueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.stepLocked(-1, true)
+}
+
+// Select the entry at index i of the (unshuffled) queue
+func (q *playQueue) jump(i int) *queueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for pos, idx := range q.order {
+		if idx == i {
+			q.pos = pos
+			return q.entries[idx]
+		}
+	}
+	return nil
+}
+
+// Make entry the current position of the queue (e.g. after it was prepared with peekNext)
+func (q *playQueue) jumpToEntry(entry *queueEntry) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for pos, idx := range q.order {
+		if q.entries[idx] == entry {
+			q.pos = pos
+			return
+		}
+	}
+}
+
+func (q *playQueue) current() *queueEntry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pos < 0 || q.pos >= len(q.order) {
+		return nil
+	}
+	return q.entries[q.order[q.pos]]
+}
+
+func (q *playQueue) setShuffle(shuffle bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.shuffle = shuffle
+	q.rebuildOrderLocked()
+}
+
+func (q *playQueue) cycleRepeat() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.repeat = (q.repeat + 1) % 3
+}
+
+func (q *playQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Show the metadata of the loaded entry in the queue panel
+func (q *playQueue) updateCurrent(pUnit *playbackUnit) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.pos < 0 || q.pos >= len(q.order) || pUnit == nil {
+		return
+	}
+	e := q.entries[q.order[q.pos]]
+	if pUnit.Metadata != nil && pUnit.Metadata.Title() != "" {
+		e.name = pUnit.Metadata.Artist() + " - " + pUnit.Metadata.Title()
+	}
+}
+
+// Eject whatever is playing and start playing entry
+func playEntry(w *app.Window, entry *queueEntry) {
+	if entry == nil {
+		return
+	}
+	eject()
+	loadAndPlay(w, entry.open())
+}
+
+func playNext(w *app.Window) {
+	playEntry(w, queue.next(true))
+}
+
+func playPrevious(w *app.Window) {
+	playEntry(w, queue.previous())
+}
+
+func renderQueue(gtx layout.Context, th *material.Theme) layout.Dimensions {
+	q := queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.entries) == 0 {
+		return layout.Dimensions{}
+	}
+
+	current := -1
+	if q.pos >= 0 && q.pos < len(q.order) {
+		current = q.order[q.pos]
+	}
+
+	gtx.Constraints.Min.X = gtx.Dp(200)
+	gtx.Constraints.Max.X = gtx.Dp(200)
+	return layout.Inset{Left: unit.Dp(5), Right: unit.Dp(5), Top: unit.Dp(4)}.Layout(gtx, func(gtx C) D {
+		return layout.Flex{Axis: layout.Vertical}.Layout(gtx,
+			layout.Rigid(func(gtx C) D {
+				return layout.Flex{Axis: layout.Horizontal, Spacing: layout.SpaceBetween}.Layout(gtx,
+					layout.Flexed(1, material.Button(th, &prevButton, "Prev").Layout),
+					layout.Rigid(layout.Spacer{Width: itemSpacing}.Layout),
+					layout.Flexed(1, material.Button(th, &nextButton, "Next").Layout),
+					layout.Rigid(layout.Spacer{Width: itemSpacing}.Layout),
+					layout.Flexed(1, material.Button(th, &addButton, "Add").Layout),
+				)
+			}),
+			layout.Rigid(layout.Spacer{Height: itemSpacing}.Layout),
+			layout.Rigid(func(gtx C) D {
+				return layout.Flex{Axis: layout.Horizontal, Alignment: layout.Middle}.Layout(gtx,
+					layout.Flexed(1, material.Button(th, &repeatButton, q.repeat.String()).Layout),
+					layout.Rigid(material.CheckBox(th, &shuffleToggle, "Shuffle").Layout),
+				)
+			}),
+			layout.Rigid(layout.Spacer{Height: itemSpacing}.Layout),
+			layout.Flexed(1, func(gtx C) D {
+				return material.List(th, &queueList).Layout(gtx, len(q.entries), func(gtx C, i int) D {
+					e := q.entries[i]
+					return e.click.Layout(gtx, func(gtx C) D {
+						label := material.Body2(th, e.name)
+						label.MaxLines = 1
+						if i == current {
+							label.Color = color.NRGBA{R: 255, G: 200, B: 0, A: 255}
+						}
+						return layout.Inset{Top: unit.Dp(2), Bottom: unit.Dp(2)}.Layout(gtx, label.Layout)
+					})
+				})
+			}),
+		)
+	})
+}
+
+// Index of the queue entry clicked in the queue panel, -1 if none
+func clickedQueueEntry(gtx layout.Context) int {
+	q := queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, e := range q.entries {
+		if e.click.Clicked(gtx) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/dhowden/tag"
+	"github.com/gopxl/beep/v2/speaker"
+)
+
+// Values of normalizeMode
+const (
+	normalizeOff      = "off"
+	normalizeTrack    = "track"    // ReplayGain track gain, measured loudness without tags
+	normalizeAlbum    = "album"    // ReplayGain album gain, falls back like normalizeTrack
+	normalizeLoudness = "loudness" // always use the measured loudness
+)
+
+// replayGain holds the gain tags of a track, gains are in dB and peaks are linear (1.0 is full scale)
+type replayGain struct {
+	trackGain, trackPeak float64
+	albumGain, albumPeak float64
+	hasTrack, hasAlbum   bool
+}
+
+// Read ReplayGain (ID3 TXXX frames or Vorbis comments) and R128 gain tags from m
+func parseReplayGain(m tag.Metadata) replayGain {
+	var rg replayGain
+	if m == nil {
+		return rg
+	}
+	var r128Track, r128Album float64
+	var hasR128Track, hasR128Album bool
+	for key, raw := range m.Raw() {
+		var value string
+		switch v := raw.(type) {
+		case *tag.Comm: // ID3 TXXX frames keep the name in the description
+			key, value = v.Description, v.Text
+		case string:
+			value = v
+		default:
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "replaygain_track_gain":
+			rg.trackGain, rg.hasTrack = parseGainValue(value)
+		case "replaygain_track_peak":
+			rg.trackPeak, _ = parseGainValue(value)
+		case "replaygain_album_gain":
+			rg.albumGain, rg.hasAlbum = parseGainValue(value)
+		case "replaygain_album_peak":
+			rg.albumPeak, _ = parseGainValue(value)
+		case "r128_track_gain":
+			r128Track, hasR128Track = parseR128Gain(value)
+		case "r128_album_gain":
+			r128Album, hasR128Album = parseR128Gain(value)
+		}
+	}
+
+	// R128 gains target -23 LUFS, ReplayGain 2.0 targets -18 LUFS
+	if !rg.hasTrack && hasR128Track {
+		rg.trackGain, rg.hasTrack = r128Track+5, true
+	}
+	if !rg.hasAlbum && hasR128Album {
+		rg.albumGain, rg.hasAlbum = r128Album+5, true
+	}
+	return rg
+}
+
+// Parse a value like "-6.48 dB" or "0.988553"
+func parseGainValue(s string) (float64, bool) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(s, "dB"), "db"))
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+// Parse an R128 gain, a Q7.8 fixed point number of dB
+func parseR128Gain(s string) (float64, bool) {
+	v, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, false
+	}
+	return float64(v) / 256, true
+}
+
+// Return the tag gain in dB for mode, album gain falls back to the track gain when it's missing
+func (rg replayGain) gain(mode string, preventClipping bool) (db float64, ok bool) {
+	var peak float64
+	switch {
+	case mode == normalizeAlbum && rg.hasAlbum:
+		db, peak = rg.albumGain, rg.albumPeak
+	case (mode == normalizeAlbum || mode == normalizeTrack) && rg.hasTrack:
+		db, peak = rg.trackGain, rg.trackPeak
+	default:
+		return 0, false
+	}
+	if preventClipping && peak > 0 {
+		db = min(db, -20*math.Log10(peak))
+	}
+	return db, true
+}
+
+// Return the gain in dB which normalizes the unit with n, from its tags or measured loudness depending on the mode
+func (p *playbackUnit) normalizationGain(n normalization) float64 {
+	if n.mode == normalizeOff {
+		return 0
+	}
+	if n.mode != normalizeLoudness {
+		if db, ok := p.replayGain.gain(n.mode, n.preventClipping); ok {
+			return db
+		}
+	}
+	measured, ok := p.loudness.measured()
+	if !ok || math.IsInf(measured.Integrated, 0) { // not measured yet or silent
+		return 0
+	}
+	db := n.target - measured.Integrated
+	if n.preventClipping {
+		db = min(db, -measured.TruePeak)
+	}
+	return db
+}
+
+// Set the unit's normalization gain, called again once the loudness analysis finished
+func (p *playbackUnit) applyNormalization(n normalization) {
+	if p == nil {
+		return
+	}
+	db := p.normalizationGain(n)
+	speaker.Lock()
+	p.gain.Gain = math.Pow(10, db/20) - 1
+	speaker.Unlock()
+}
+
+// Return the applied normalization gain in dB
+func (p *playbackUnit) appliedGain() float64 {
+	if p == nil {
+		return 0
+	}
+	speaker.Lock()
+	defer speaker.Unlock()
+	return 20 * math.Log10(1+p.gain.Gain)
+}
@@ -0,0 +1,54 @@
+package main
+
+import "sync"
+
+// playbackSettings are the options a playback unit is set up with, edited in the Options dialog
+// NOTE: units are created on background goroutines, read and change them with currentSettings and updateSettings
+type playbackSettings struct {
+	speed         float64 // 0.5 (half speed) to 2.0 (double speed)
+	preservePitch bool    // time-stretch instead of resampling (tape-style) when changing speed
+	pitch         float64 // in semitones, fractions for cents
+	eqEnabled     bool
+	eqBands       [eqBandCount]eqBand
+	normalize     normalization
+	loopCrossfade bool // blend the end of the A-B loop into its start
+}
+
+// normalization are the loudness normalization settings, see playbackUnit.normalizationGain
+type normalization struct {
+	mode            string  // one of the normalizeMode values
+	target          float64 // LUFS that measured tracks are normalized to
+	preventClipping bool    // lower the gain so the (true) peak doesn't exceed full scale
+}
+
+var settingsMu sync.Mutex // guards settings
+var settings = playbackSettings{
+	speed:         1,
+	preservePitch: true,
+	eqBands:       eqPresets["flat"],
+	normalize:     normalization{mode: normalizeOff, target: -14, preventClipping: true},
+	loopCrossfade: true,
+}
+
+// Return a copy of the settings, safe to call from any goroutine
+func currentSettings() playbackSettings {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	return settings
+}
+
+// Change the settings with edit and return a copy of the result
+func updateSettings(edit func(s *playbackSettings)) playbackSettings {
+	settingsMu.Lock()
+	defer settingsMu.Unlock()
+	edit(&settings)
+	return settings
+}
+
+// Return the equalizer bands to apply, nil while the equalizer is turned off
+func (s playbackSettings) equalizerBands() []eqBand {
+	if !s.eqEnabled {
+		return nil
+	}
+	return s.eqBands[:]
+}
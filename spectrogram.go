@@ -0,0 +1,288 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/cmplx"
+	"strconv"
+	"sync"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget"
+	"github.com/gopxl/beep/v2"
+)
+
+const spectrogramRows = 256
+const spectrogramColumns = 512       // history of the live (scrolling) spectrogram
+const trackSpectrogramColumns = 1024 // resolution of the whole track spectrogram
+
+var spectrogramColormap widget.Enum // one of the colormaps keys, set in init
+var spectrogramRange widget.Enum    // displayed dynamic range in dB, set in init
+
+// colormap maps a level from 0 (floor) to 255 (0 dB) to a color
+type colormap [256]color.NRGBA
+
+// Build a colormap by linearly interpolating between evenly spaced stops
+func gradientColormap(stops ...color.NRGBA) colormap {
+	var cmap colormap
+	lerp := func(a, b uint8, t float64) uint8 {
+		return uint8(float64(a) + (float64(b)-float64(a))*t)
+	}
+	for i := range cmap {
+		pos := float64(i) / 255 * float64(len(stops)-1)
+		idx := min(int(pos), len(stops)-2)
+		t := pos - float64(idx)
+		a, b := stops[idx], stops[idx+1]
+		cmap[i] = color.NRGBA{R: lerp(a.R, b.R, t), G: lerp(a.G, b.G, t), B: lerp(a.B, b.B, t), A: 255}
+	}
+	return cmap
+}
+
+var colormaps = map[string]colormap{
+	"magma": gradientColormap(
+		color.NRGBA{R: 0, G: 0, B: 4},
+		color.NRGBA{R: 59, G: 15, B: 112},
+		color.NRGBA{R: 140, G: 41, B: 129},
+		color.NRGBA{R: 222, G: 73, B: 104},
+		color.NRGBA{R: 254, G: 159, B: 109},
+		color.NRGBA{R: 252, G: 253, B: 191},
+	),
+	"viridis": gradientColormap(
+		color.NRGBA{R: 68, G: 1, B: 84},
+		color.NRGBA{R: 59, G: 82, B: 139},
+		color.NRGBA{R: 33, G: 145, B: 140},
+		color.NRGBA{R: 94, G: 201, B: 98},
+		color.NRGBA{R: 253, G: 231, B: 37},
+	),
+	"gray": gradientColormap(color.NRGBA{}, color.NRGBA{R: 255, G: 255, B: 255}),
+}
+
+// Return the selected colormap, "waveform" follows the waveform color pickers
+func currentColormap() colormap {
+	if cmap, ok := colormaps[spectrogramColormap.Value]; ok {
+		return cmap
+	}
+	return gradientColormap(color.NRGBA{}, waveformColor1, waveformColor2)
+}
+
+// Return the selected dynamic range in dB (e.g. 90 shows -90 dB to 0 dB)
+func currentDbRange() float64 {
+	dbRange, err := strconv.Atoi(spectrogramRange.Value)
+	if err != nil || dbRange <= 0 {
+		return 90
+	}
+	return float64(dbRange)
+}
+
+// Lowest and highest FFT bin of each row, rows are log spaced with row 0 at the highest frequency
+func spectrogramRowBins(rows int, sampleRate float64) [][2]int {
+	nyquist := sampleRate / 2
+	binWidth := sampleRate / fftSize
+	bins := make([][2]int, rows)
+	for row := range bins {
+		band := rows - 1 - row
+		lo := int(spectrumMinFreq * math.Pow(nyquist/spectrumMinFreq, float64(band)/float64(rows)) / binWidth)
+		hi := int(spectrumMinFreq * math.Pow(nyquist/spectrumMinFreq, float64(band+1)/float64(rows)) / binWidth)
+		lo = min(max(lo, 1), fftSize/2-1)
+		hi = min(max(hi, lo+1), fftSize/2)
+		bins[row] = [2]int{lo, hi}
+	}
+	return bins
+}
+
+// Fill column with the level in dB of each row of the transformed bins
+func spectrogramColumn(bins []complex128, rowBins [][2]int, column []float32) {
+	scale := 2 / (fftSize * 0.5) // one sided spectrum, Hann window has a coherent gain of 0.5
+	for row, r := range rowBins {
+		var magnitude float64
+		for bin := r[0]; bin < r[1]; bin++ {
+			magnitude = max(magnitude, cmplx.Abs(bins[bin])*scale)
+		}
+		column[row] = float32(20 * math.Log10(math.Max(magnitude, 1e-9)))
+	}
+}
+
+// Color for a level in dB with the given colormap and range
+func dbColor(db float32, cmap *colormap, dbRange float64) color.NRGBA {
+	level := min(max((float64(db)+dbRange)/dbRange, 0), 1)
+	return cmap[int(level*255)]
+}
+
+// Draw img stretched to width x height
+func drawImageScaled(gtx layout.Context, imgOp paint.ImageOp, width, height int) {
+	size := imgOp.Size()
+	scale := f32.Pt(float32(width)/float32(size.X), float32(height)/float32(size.Y))
+	defer op.Affine(f32.Affine2D{}.Scale(f32.Point{}, scale)).Push(gtx.Ops).Pop()
+	imgOp.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+}
+
+// liveSpectrogram scrolls a new FFT column of the latest played audio into its image every frame
+type liveSpectrogram struct {
+	img          *image.NRGBA
+	window       []float64
+	frames       [][2]float32
+	bins         []complex128
+	column       []float32
+	rowBins      [][2]int
+	sampleRate   float64
+	lastWritePos int
+}
+
+var spectrogram = &liveSpectrogram{
+	img:          image.NewNRGBA(image.Rect(0, 0, spectrogramColumns, spectrogramRows)),
+	window:       hannWindow(fftSize),
+	frames:       make([][2]float32, fftSize),
+	bins:         make([]complex128, fftSize),
+	column:       make([]float32, spectrogramRows),
+	lastWritePos: -1,
+}
+
+// Scroll the image left and paint the spectrum of the latest samples in the last column
+func (s *liveSpectrogram) update(sampleRate float64) {
+	if audio.Ring().Written() == s.lastWritePos { // no new audio (e.g. paused)
+		return
+	}
+	s.lastWritePos = audio.Ring().Written()
+	if s.sampleRate != sampleRate {
+		s.rowBins = spectrogramRowBins(spectrogramRows, sampleRate)
+		s.sampleRate = sampleRate
+	}
+
+	audio.Ring().ReadFrames(s.frames)
+	for i, frame := range s.frames { // mono sum with window applied
+		s.bins[i] = complex((float64(frame[0])+float64(frame[1]))/2*s.window[i], 0)
+	}
+	fft(s.bins)
+	spectrogramColumn(s.bins, s.rowBins, s.column)
+
+	cmap := currentColormap()
+	dbRange := currentDbRange()
+	last := spectrogramColumns - 1
+	for row, db := range s.column {
+		rowPix := s.img.Pix[row*s.img.Stride : row*s.img.Stride+spectrogramColumns*4]
+		copy(rowPix, rowPix[4:])
+		s.img.SetNRGBA(last, row, dbColor(db, &cmap, dbRange))
+	}
+}
+
+func (s *liveSpectrogram) reset() {
+	clear(s.img.Pix)
+	s.lastWritePos = -1
+}
+
+func renderSpectrogram(gtx layout.Context, width, height int) layout.Dimensions {
+	spectrogram.update(float64(globalSampleRate))
+	imgOp := paint.NewImageOp(spectrogram.img)
+	imgOp.Filter = paint.FilterLinear
+	drawImageScaled(gtx, imgOp, width, height)
+	return layout.Dimensions{Size: image.Point{X: width, Y: height}}
+}
+
+// trackSpectrogram is a spectrogram of the whole track computed in the background, see trackAnalyzer
+type trackSpectrogram struct {
+	mu       sync.Mutex
+	hop      float64 // samples between columns
+	window   []float64
+	history  []float64 // ring of the last fftSize mono samples
+	histPos  int
+	consumed int // samples processed so far
+	bins     []complex128
+	rowBins  [][2]int
+	db       []float32 // trackSpectrogramColumns x spectrogramRows levels in dB, column major
+	computed int       // columns computed so far
+
+	// image of the computed columns, painted incrementally as columns arrive
+	img         *image.NRGBA
+	imgOp       paint.ImageOp
+	imgComputed int
+	imgCmap     colormap
+	imgRange    float64
+}
+
+func newTrackSpectrogram(totalSamples int, sampleRate beep.SampleRate) *trackSpectrogram {
+	hop := float64(totalSamples) / trackSpectrogramColumns
+	if hop <= 0 { // unknown length
+		hop = fftSize
+	}
+	return &trackSpectrogram{
+		hop:     hop,
+		window:  hannWindow(fftSize),
+		history: make([]float64, fftSize),
+		bins:    make([]complex128, fftSize),
+		rowBins: spectrogramRowBins(spectrogramRows, float64(sampleRate)),
+		db:      make([]float32, trackSpectrogramColumns*spectrogramRows),
+	}
+}
+
+func (t *trackSpectrogram) process(samples [][2]float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, sample := range samples {
+		t.history[t.histPos] = (sample[0] + sample[1]) / 2
+		t.histPos = (t.histPos + 1) % fftSize
+		t.consumed++
+		if t.computed < trackSpectrogramColumns && float64(t.consumed) >= float64(t.computed+1)*t.hop {
+			t.computeColumnLocked()
+		}
+	}
+}
+
+// Transform the latest fftSize samples into the next column
+func (t *trackSpectrogram) computeColumnLocked() {
+	for i := range fftSize {
+		t.bins[i] = complex(t.history[(t.histPos+i)%fftSize]*t.window[i], 0)
+	}
+	fft(t.bins)
+	column := t.db[t.computed*spectrogramRows : (t.computed+1)*spectrogramRows]
+	spectrogramColumn(t.bins, t.rowBins, column)
+	t.computed++
+}
+
+func (t *trackSpectrogram) finish() {}
+
+// Return the spectrogram as an image, only new columns are painted unless the colormap or range changed
+func (t *trackSpectrogram) image() paint.ImageOp {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	cmap := currentColormap()
+	dbRange := currentDbRange()
+	if t.img != nil && t.computed == t.imgComputed && cmap == t.imgCmap && dbRange == t.imgRange {
+		return t.imgOp
+	}
+
+	from := t.imgComputed
+	if t.img == nil {
+		t.img = image.NewNRGBA(image.Rect(0, 0, trackSpectrogramColumns, spectrogramRows))
+		from = 0
+	} else if cmap != t.imgCmap || dbRange != t.imgRange {
+		from = 0
+	}
+	for col := from; col < t.computed; col++ {
+		for row := range spectrogramRows {
+			t.img.SetNRGBA(col, row, dbColor(t.db[col*spectrogramRows+row], &cmap, dbRange))
+		}
+	}
+	t.imgOp = paint.NewImageOp(t.img) // new op so the changed pixels are uploaded again
+	t.imgOp.Filter = paint.FilterLinear
+	t.imgComputed, t.imgCmap, t.imgRange = t.computed, cmap, dbRange
+	return t.imgOp
+}
+
+// Draw the whole track spectrogram with a playhead at progress
+func renderTrackSpectrogram(gtx layout.Context, t *trackSpectrogram, progress float32, width, height int) layout.Dimensions {
+	if t == nil {
+		return layout.Dimensions{}
+	}
+	drawImageScaled(gtx, t.image(), width, height)
+
+	playheadX := int(min(max(progress, 0), 1) * float32(width))
+	paint.FillShape(gtx.Ops, color.NRGBA{R: 255, G: 255, B: 255, A: 255},
+		clip.Rect{Min: image.Pt(playheadX-1, 0), Max: image.Pt(playheadX+1, height)}.Op())
+	return layout.Dimensions{Size: image.Point{X: width, Y: height}}
+}
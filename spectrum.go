@@ -0,0 +1,169 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/cmplx"
+	"time"
+
+	"gioui.org/f32"
+	"gioui.org/layout"
+	"gioui.org/op"
+	"gioui.org/op/clip"
+	"gioui.org/op/paint"
+	"gioui.org/widget"
+	"gioui.org/widget/material"
+)
+
+const fftSize = 2048 // ~46ms at 44.1kHz
+const spectrumBands = 64
+const spectrumMinFreq = 20.0
+const spectrumMinDb = -90.0
+const peakHoldTime = time.Second
+const peakFallRate = 0.6 // fraction of the display height per second
+
+var spectrumSmoothing widget.Float // 0 (none) to ~1 (very slow), set in init
+
+// spectrumAnalyzer turns the latest samples played into log spaced frequency bands
+type spectrumAnalyzer struct {
+	window   []float64
+	frames   [][2]float32
+	bins     []complex128
+	bands    []float32 // smoothed band levels from 0 to 1
+	peaks    []float32 // peak-hold levels from 0 to 1
+	peakTime []time.Time
+	lastTime time.Time
+}
+
+var spectrum = newSpectrumAnalyzer()
+
+func newSpectrumAnalyzer() *spectrumAnalyzer {
+	return &spectrumAnalyzer{
+		window:   hannWindow(fftSize),
+		frames:   make([][2]float32, fftSize),
+		bins:     make([]complex128, fftSize),
+		bands:    make([]float32, spectrumBands),
+		peaks:    make([]float32, spectrumBands),
+		peakTime: make([]time.Time, spectrumBands),
+	}
+}
+
+// Frequency of the lower edge of band i, bands are spaced logarithmically up to nyquist
+func bandEdge(i int, nyquist float64) float64 {
+	return spectrumMinFreq * math.Pow(nyquist/spectrumMinFreq, float64(i)/spectrumBands)
+}
+
+// Analyze the latest samples and update the smoothed bands and peaks
+func (s *spectrumAnalyzer) update(sampleRate float64, smoothing float32) {
+	audio.Ring().ReadFrames(s.frames)
+	for i, frame := range s.frames { // mono sum with window applied
+		s.bins[i] = complex((float64(frame[0])+float64(frame[1]))/2*s.window[i], 0)
+	}
+	fft(s.bins)
+
+	now := time.Now()
+	elapsed := float32(now.Sub(s.lastTime).Seconds())
+	if s.lastTime.IsZero() || elapsed > 1 {
+		elapsed = 0
+	}
+	s.lastTime = now
+	smoothing = min(max(smoothing, 0), 0.95) // never freeze the bands completely
+
+	nyquist := sampleRate / 2
+	binWidth := sampleRate / fftSize
+	scale := 2 / (fftSize * 0.5) // one sided spectrum, Hann window has a coherent gain of 0.5
+	for band := range spectrumBands {
+		lo := int(bandEdge(band, nyquist) / binWidth)
+		hi := int(bandEdge(band+1, nyquist) / binWidth)
+		lo = min(max(lo, 1), fftSize/2-1)
+		hi = min(max(hi, lo+1), fftSize/2) // low bands can be narrower than a single bin
+
+		var magnitude float64
+		for bin := lo; bin < hi; bin++ {
+			magnitude = max(magnitude, cmplx.Abs(s.bins[bin])*scale)
+		}
+		db := 20 * math.Log10(math.Max(magnitude, 1e-9))
+		level := float32(min(max((db-spectrumMinDb)/-spectrumMinDb, 0), 1))
+
+		s.bands[band] = s.bands[band]*smoothing + level*(1-smoothing)
+
+		// Hold peaks for a while then let them fall
+		if s.bands[band] >= s.peaks[band] {
+			s.peaks[band] = s.bands[band]
+			s.peakTime[band] = now
+		} else if now.Sub(s.peakTime[band]) > peakHoldTime {
+			s.peaks[band] = max(s.peaks[band]-peakFallRate*elapsed, s.bands[band])
+		}
+	}
+}
+
+func (s *spectrumAnalyzer) reset() {
+	for i := range s.bands {
+		s.bands[i] = 0
+		s.peaks[i] = 0
+	}
+	s.lastTime = time.Time{}
+}
+
+func renderSpectrum(gtx layout.Context, th *material.Theme, width, height int) layout.Dimensions {
+	spectrum.update(float64(globalSampleRate), spectrumSmoothing.Value)
+
+	nyquist := float64(globalSampleRate) / 2
+	barWidth := float32(width) / spectrumBands
+	gap := max(barWidth*0.15, 1)
+
+	// Frequency grid lines with labels
+	logRange := math.Log(nyquist / spectrumMinFreq)
+	for _, grid := range []struct {
+		freq  float64
+		label string
+	}{{100, "100"}, {1000, "1k"}, {10000, "10k"}} {
+		x := int(float64(width) * math.Log(grid.freq/spectrumMinFreq) / logRange)
+		paint.FillShape(gtx.Ops, color.NRGBA{R: 255, G: 255, B: 255, A: 30},
+			clip.Rect{Min: image.Pt(x, 0), Max: image.Pt(x+1, height)}.Op())
+		offset := op.Offset(image.Pt(x+2, 0)).Push(gtx.Ops)
+		label := material.Caption(th, grid.label)
+		label.Color = color.NRGBA{R: 255, G: 255, B: 255, A: 120}
+		labelGtx := gtx
+		labelGtx.Constraints.Min = image.Point{}
+		label.Layout(labelGtx)
+		offset.Pop()
+	}
+
+	var bars, peaks clip.Path
+	bars.Begin(gtx.Ops)
+	for band, level := range spectrum.bands {
+		x := float32(band) * barWidth
+		top := float32(height) * (1 - level)
+		bars.MoveTo(f32.Pt(x, float32(height)))
+		bars.LineTo(f32.Pt(x+barWidth-gap, float32(height)))
+		bars.LineTo(f32.Pt(x+barWidth-gap, top))
+		bars.LineTo(f32.Pt(x, top))
+		bars.Close()
+	}
+	clipStack := clip.Outline{Path: bars.End()}.Op().Push(gtx.Ops)
+	paint.LinearGradientOp{ // Color bars from the bottom (left color) to the top (right color)
+		Stop1:  f32.Pt(0, float32(height)),
+		Stop2:  f32.Pt(0, 0),
+		Color1: waveformColor1,
+		Color2: waveformColor2,
+	}.Add(gtx.Ops)
+	paint.PaintOp{}.Add(gtx.Ops)
+	clipStack.Pop()
+
+	peaks.Begin(gtx.Ops)
+	for band, level := range spectrum.peaks {
+		if level <= 0 {
+			continue
+		}
+		x := float32(band) * barWidth
+		y := float32(height) * (1 - level)
+		peaks.MoveTo(f32.Pt(x, y))
+		peaks.LineTo(f32.Pt(x+barWidth-gap, y))
+	}
+	paint.FillShape(gtx.Ops, color.NRGBA{R: 255, G: 255, B: 255, A: 220},
+		clip.Stroke{Path: peaks.End(), Width: 2}.Op())
+
+	return layout.Dimensions{Size: image.Point{X: width, Y: height}}
+}
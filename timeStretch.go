@@ -0,0 +1,165 @@
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+)
+
+const stretchFrameDuration = 23 * time.Millisecond // long enough for the pitch periods of speech and most instruments
+const stretchCorrelationStride = 4                 // only correlate every nth sample to keep the search cheap on wasm
+const minPlaybackSpeed, maxPlaybackSpeed = 0.5, 2.0
+
+// timeStretcher changes the playback speed without changing the pitch using WSOLA
+// (waveform similarity overlap-add): frames are read from the input every speed*hop samples,
+// shifted by up to tolerance to best continue the previous frame, and overlap-added every hop samples
+type timeStretcher struct {
+	s         beep.Streamer
+	speed     float64
+	frameSize int
+	hop       int // output (synthesis) hop, 50% overlap of Hann windows sums to 1
+	tolerance int // how far (in samples) a frame may move to line up with the previous one
+	window    []float64
+
+	in      [][2]float64 // buffered input, in[0] is at absolute input position inOff
+	inOff   int
+	srcDone bool
+
+	nextPos  float64 // nominal input position of the next frame
+	prevPos  int     // input position of the previous frame, -1 before the first frame
+	acc      [][2]float64
+	out      [][2]float64 // finished output waiting to be streamed
+	finished bool
+	readBuf  [][2]float64
+}
+
+// Create a timeStretcher for s, frames are sized by the sample rate so it sounds the same at any rate
+func newTimeStretcher(s beep.Streamer, sampleRate beep.SampleRate) *timeStretcher {
+	frameSize := max(sampleRate.N(stretchFrameDuration)&^1, 64) // even, so the hop is exactly half a frame
+	t := &timeStretcher{
+		s:         s,
+		speed:     1,
+		frameSize: frameSize,
+		hop:       frameSize / 2,
+		tolerance: frameSize / 4,
+		window:    hannWindow(frameSize),
+		acc:       make([][2]float64, frameSize),
+		readBuf:   make([][2]float64, 512),
+	}
+	t.reset()
+	return t
+}
+
+// Drop any buffered audio, e.g. after seeking
+func (t *timeStretcher) reset() {
+	t.in = t.in[:0]
+	t.inOff = 0
+	t.srcDone = false
+	t.nextPos = 0
+	t.prevPos = -1
+	clear(t.acc)
+	t.out = t.out[:0]
+	t.finished = false
+}
+
+// Set the playback speed (e.g. 0.5 for half speed), 1 passes the input through untouched
+func (t *timeStretcher) setSpeed(speed float64) {
+	speed = min(max(speed, minPlaybackSpeed), maxPlaybackSpeed)
+	if (speed == 1) != (t.speed == 1) { // start from a clean state when switching between bypass and stretching
+		t.reset()
+	}
+	t.speed = speed
+}
+
+// Read from the source until the input reaches absolute position end (or the source is drained)
+func (t *timeStretcher) fill(end int) {
+	for !t.srcDone && t.inOff+len(t.in) < end {
+		n, ok := t.s.Stream(t.readBuf)
+		t.in = append(t.in, t.readBuf[:n]...)
+		if !ok {
+			t.srcDone = true
+		}
+	}
+}
+
+// Input sample at absolute position pos, silence outside of the buffered input
+func (t *timeStretcher) input(pos int) [2]float64 {
+	i := pos - t.inOff
+	if i < 0 || i >= len(t.in) {
+		return [2]float64{}
+	}
+	return t.in[i]
+}
+
+// Find the frame start within tolerance of pos which best continues the previous frame
+func (t *timeStretcher) bestOffset(pos int) int {
+	if t.prevPos < 0 {
+		return pos
+	}
+	target := t.prevPos + t.hop // where the previous frame would naturally continue
+	best, bestCorr := pos, math.Inf(-1)
+	for candidate := pos - t.tolerance; candidate <= pos+t.tolerance; candidate++ {
+		if candidate < t.inOff || candidate+t.frameSize > t.inOff+len(t.in) {
+			continue
+		}
+		var corr float64 // cross-correlation of the mono sums
+		for i := 0; i < t.frameSize; i += stretchCorrelationStride {
+			a := t.in[candidate-t.inOff+i]
+			b := t.input(target + i)
+			corr += (a[0] + a[1]) * (b[0] + b[1])
+		}
+		if corr > bestCorr {
+			best, bestCorr = candidate, corr
+		}
+	}
+	return best
+}
+
+// Overlap-add the next frame and move hop finished samples to out
+func (t *timeStretcher) processFrame() {
+	pos := int(t.nextPos)
+	t.fill(max(pos+t.tolerance, t.prevPos+t.hop) + t.frameSize)
+	if t.srcDone && pos >= t.inOff+len(t.in) { // flush the tail of the last frame
+		t.out = append(t.out, t.acc[:t.frameSize-t.hop]...)
+		t.finished = true
+		return
+	}
+
+	start := t.bestOffset(pos)
+	for i := range t.frameSize {
+		sample := t.input(start + i)
+		t.acc[i][0] += sample[0] * t.window[i]
+		t.acc[i][1] += sample[1] * t.window[i]
+	}
+	t.out = append(t.out, t.acc[:t.hop]...)
+	copy(t.acc, t.acc[t.hop:])
+	clear(t.acc[t.frameSize-t.hop:])
+
+	t.prevPos = start
+	t.nextPos += t.speed * float64(t.hop)
+
+	// Drop input which no following frame can use anymore
+	keepFrom := min(int(t.nextPos)-t.tolerance, t.prevPos+t.hop)
+	if drop := keepFrom - t.inOff; drop > 0 {
+		drop = min(drop, len(t.in))
+		t.in = append(t.in[:0], t.in[drop:]...)
+		t.inOff += drop
+	}
+}
+
+func (t *timeStretcher) Stream(samples [][2]float64) (n int, ok bool) {
+	if t.speed == 1 {
+		return t.s.Stream(samples)
+	}
+	for len(t.out) < len(samples) && !t.finished {
+		t.processFrame()
+	}
+	n = copy(samples, t.out)
+	t.out = append(t.out[:0], t.out[n:]...)
+	return n, n > 0 || !t.finished
+}
+
+func (t *timeStretcher) Err() error {
+	return t.s.Err()
+}
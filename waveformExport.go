@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"gioui.org/app"
+	"gioui.org/widget"
+	"quickClip/player"
+	"quickClip/player/waveformui"
+)
+
+// Values of waveformExportFormat
+const (
+	exportPNG = "png"
+	exportSVG = "svg"
+)
+
+var waveformExportButton widget.Clickable
+var waveformExportSize widget.Enum   // "<width>x<height>", set in init
+var waveformExportFormat widget.Enum // exportPNG or exportSVG
+
+var waveformExportSizes = []string{"400x100", "800x200", "1600x400", "3200x800"}
+
+// Parse a "<width>x<height>" export size
+func parseExportSize(s string) (width, height int, err error) {
+	w, h, ok := strings.Cut(s, "x")
+	if ok {
+		width, err = strconv.Atoi(w)
+	}
+	if ok && err == nil {
+		height, err = strconv.Atoi(h)
+	}
+	if !ok || err != nil || width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid export size %q", s)
+	}
+	return width, height, nil
+}
+
+// Return one peak per column of the whole track, decoding it again if the background analysis hasn't finished
+func (p *playbackUnit) waveformColumns(width int) ([]player.Peak, error) {
+	if p == nil {
+		return nil, fmt.Errorf("waveformColumns: playbackUnit was nil")
+	}
+	if p.overview != nil && p.overview.Done() {
+		return p.overview.Columns(width), nil
+	}
+
+	decoder, _, err := p.openDecoder()
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	overview, err := player.ReadOverview(decoder, decoder.Len())
+	if err != nil {
+		return nil, err
+	}
+	return overview.Columns(width), nil
+}
+
+// Return the top and bottom y of a column, mapped like renderWaveform and at least a pixel tall
+func waveformColumnSpan(p player.Peak, height int) (top, bottom float32) {
+	centerY := float32(height) / 2
+	top = centerY - waveformui.Level(max(p.Max, 0))*centerY
+	bottom = centerY + waveformui.Level(min(p.Min, 0))*centerY
+	return top, max(bottom, top+1)
+}
+
+// Color of the waveform gradient at x, y, running diagonally from the top left like renderWaveform
+func waveformGradient(x, y, width, height int) color.NRGBA {
+	t := float32(x*width+y*height) / float32(width*width+height*height)
+	lerp := func(a, b uint8) uint8 {
+		return uint8(float32(a) + (float32(b)-float32(a))*t + 0.5)
+	}
+	c1, c2 := waveformColor1, waveformColor2
+	return color.NRGBA{R: lerp(c1.R, c2.R), G: lerp(c1.G, c2.G), B: lerp(c1.B, c2.B), A: lerp(c1.A, c2.A)}
+}
+
+// Draw the columns as a width x height image on a transparent background
+func waveformImage(cols []player.Peak, width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for x, p := range cols {
+		if p.Min > p.Max { // no samples
+			continue
+		}
+		top, bottom := waveformColumnSpan(p, height)
+		for y := max(int(top), 0); y < min(int(bottom+0.5), height); y++ {
+			img.SetNRGBA(x, y, waveformGradient(x, y, width, height))
+		}
+	}
+	return img
+}
+
+func writeWaveformPNG(w io.Writer, cols []player.Peak, width, height int) error {
+	return png.Encode(w, waveformImage(cols, width, height))
+}
+
+// Write the columns as an SVG with a vertical line per column stroked with the waveform gradient
+func writeWaveformSVG(w io.Writer, cols []player.Peak, width, height int) error {
+	hex := func(c color.NRGBA) string { return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B) }
+	opacity := func(c color.NRGBA) float64 { return float64(c.A) / 255 }
+
+	b := bufio.NewWriter(w)
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", width, height, width, height)
+	fmt.Fprintf(b, `<defs><linearGradient id="waveform" gradientUnits="userSpaceOnUse" x1="0" y1="0" x2="%d" y2="%d">`, width, height)
+	fmt.Fprintf(b, `<stop offset="0" stop-color="%s" stop-opacity="%.3g"/>`, hex(waveformColor1), opacity(waveformColor1))
+	fmt.Fprintf(b, `<stop offset="1" stop-color="%s" stop-opacity="%.3g"/>`, hex(waveformColor2), opacity(waveformColor2))
+	b.WriteString("</linearGradient></defs>\n")
+	b.WriteString(`<path stroke="url(#waveform)" stroke-width="1" fill="none" d="`)
+	for x, p := range cols {
+		if p.Min > p.Max {
+			continue
+		}
+		top, bottom := waveformColumnSpan(p, height)
+		fmt.Fprintf(b, "M%.1f %.2fV%.2f", float32(x)+0.5, top, bottom)
+	}
+	b.WriteString("\"/>\n</svg>\n")
+	return b.Flush()
+}
+
+// Ask for a destination file and export the current track's waveform at the chosen size and format
+func exportWaveformDialog(w *app.Window) {
+	unit := currentUnit()
+	if unit == nil || fileDialog == nil {
+		return
+	}
+	width, height, err := parseExportSize(waveformExportSize.Value)
+	if err != nil {
+		log.Println("Waveform export failed:", err)
+		return
+	}
+	format := waveformExportFormat.Value
+	cols, err := unit.waveformColumns(width)
+	if err != nil {
+		log.Println("Waveform export failed:", err)
+		return
+	}
+
+	writer, err := fileDialog.CreateFile("waveform." + format)
+	if err != nil {
+		log.Println("Error creating waveform file:", err)
+		return
+	}
+	defer writer.Close()
+
+	if format == exportSVG {
+		err = writeWaveformSVG(writer, cols, width, height)
+	} else {
+		err = writeWaveformPNG(writer, cols, width, height)
+	}
+	if err != nil {
+		log.Println("Waveform export failed:", err)
+		return
+	}
+	log.Printf("Exported %dx%d waveform", width, height)
+	w.Invalidate()
+}